@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"strings"
+
+	"github.com/go-gl/gl/v2.1/gl"
+)
+
+const (
+	// How many ticks each frame of an animated tile is shown for, unless
+	// the tile says otherwise.
+	DEFAULT_FRAME_TIME = 4
+)
+
+// Animation is a tile in the atlas that cycles through frames.
+type Animation struct {
+	// Where the tile is in the atlas.
+	index int
+	// Every frame with its border, ready to be copied into the texture:
+	// flipped like the atlas is, and shrunk for each mipmap level.
+	frames [][]*image.RGBA
+	// How many ticks each frame is shown for.
+	times []int
+	// The frame being shown, and for how many ticks it has been.
+	frame, ticks int
+}
+
+// animationFile is the layout of the file of frame times that can be put
+// next to an animated tile, with the same name but ending in .json.
+type animationFile struct {
+	// How many ticks every frame is shown for.
+	FrameTime int `json:"frame_time"`
+	// How many ticks each frame is shown for, in the order of the strip.
+	FrameTimes []int `json:"frame_times"`
+}
+
+func (self *Atlas) load_animation(resources *Resources, name string, index int, img image.Image) (*Animation, error) {
+	/* Load the animated tile `name`, at `index` in the atlas, whose frames
+	   are the squares of the strip `img`.
+
+	*/
+	file := animationFile{FrameTime: DEFAULT_FRAME_TIME}
+	meta_name := strings.TrimSuffix(name, ".png") + ".json"
+	if meta, err := resources.read(meta_name); err == nil {
+		meta_name = meta.name
+		if err := json.Unmarshal(meta.data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", meta_name, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	n := b.Dy() / b.Dx()
+	animation := &Animation{index: index, times: file.FrameTimes}
+	if animation.times == nil {
+		for i := 0; i < n; i++ {
+			animation.times = append(animation.times, file.FrameTime)
+		}
+	}
+	if len(animation.times) != n {
+		return nil, fmt.Errorf("%s: %d frame times for %d frames", meta_name, len(animation.times), n)
+	}
+	for _, t := range animation.times {
+		if t < 1 {
+			return nil, fmt.Errorf("%s: frames must be shown for at least a tick", meta_name)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		levels := []*image.RGBA{flip(self.pad_tile(img, image.Pt(b.Min.X, b.Min.Y+i*b.Dx())))}
+		for len(levels) <= self.mipmap_levels() {
+			levels = append(levels, half_size(levels[len(levels)-1]))
+		}
+		animation.frames = append(animation.frames, levels)
+	}
+	return animation, nil
+}
+
+func (self *Atlas) animate(texture_id uint32) {
+	/* Move every animation on by a tick, copying the frames that are due
+	   into the texture `texture_id` the atlas was loaded into.
+
+	*/
+	for _, animation := range self.animations {
+		animation.ticks++
+		if animation.ticks < animation.times[animation.frame] {
+			continue
+		}
+		animation.ticks = 0
+		animation.frame = (animation.frame + 1) % len(animation.frames)
+
+		gl.BindTexture(gl.TEXTURE_2D, texture_id)
+		cell := self.cell_size()
+		x := animation.index % self.size * cell
+		// The texture is flipped, so the cell is counted from the bottom.
+		y := (self.size - 1 - animation.index/self.size) * cell
+		for level, img := range animation.frames[animation.frame] {
+			gl.TexSubImage2D(
+				gl.TEXTURE_2D,
+				int32(level),
+				int32(x>>uint(level)),
+				int32(y>>uint(level)),
+				int32(img.Rect.Size().X),
+				int32(img.Rect.Size().Y),
+				gl.RGBA,
+				gl.UNSIGNED_BYTE,
+				gl.Ptr(img.Pix))
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// Directory of the block textures in the resources, one square PNG per
+	// tile, named after the tile.
+	TILES_PATH = "tiles"
+)
+
+// Atlas is a single texture image packed from many tiles, so all blocks can
+// be drawn without switching textures.
+type Atlas struct {
+	image *image.RGBA
+	// How many tiles wide and high the atlas is.
+	size int
+	// How many pixels wide each tile is, and the border of copies of its
+	// edge pixels around it. The border stops the colors of the tiles next
+	// to it bleeding in when the atlas is filtered or shrunk into mipmaps.
+	tile_size, padding int
+	// Where each tile is in the atlas, counting along the rows from the top
+	// left, by name.
+	tiles map[string]int
+	// The tiles that change over time.
+	animations []*Animation
+}
+
+func pack_atlas(resources *Resources) (*Atlas, error) {
+	/* Pack every tile in the TILES_PATH directory of `resources` into an
+	   atlas. The tiles must all be squares of the same size, a multiple
+	   of 4 pixels wide, or animations: vertical strips of such squares,
+	   one per frame. The atlas is the smallest square with a power of two
+	   tiles on a side that fits them all.
+
+	*/
+	tiles, err := resources.glob(path.Join(TILES_PATH, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(tiles) == 0 {
+		return nil, fmt.Errorf("no tiles found in %s", TILES_PATH)
+	}
+	names := make([]string, 0, len(tiles))
+	for name := range tiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	self := &Atlas{size: 1, tiles: make(map[string]int)}
+	for self.size*self.size < len(names) {
+		self.size *= 2
+	}
+	for i, name := range names {
+		file := tiles[name].name
+		img, _, err := image.Decode(bytes.NewReader(tiles[name].data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		b := img.Bounds()
+		if b.Dy()%b.Dx() != 0 {
+			return nil, fmt.Errorf("%s: tile is %dx%d, not square or a strip of squares", file, b.Dx(), b.Dy())
+		}
+		if self.image == nil {
+			if b.Dx()%4 != 0 {
+				return nil, fmt.Errorf("%s: tile is %dx%d, not a multiple of 4 wide", file, b.Dx(), b.Dy())
+			}
+			self.tile_size, self.padding = b.Dx(), b.Dx()/4
+			w := self.size * self.cell_size()
+			self.image = image.NewRGBA(image.Rect(0, 0, w, w))
+		} else if b.Dx() != self.tile_size {
+			return nil, fmt.Errorf("%s: tile is %dx%d, but the tiles before it are %dx%d", file, b.Dx(), b.Dy(), self.tile_size, self.tile_size)
+		}
+		cell := self.cell_size()
+		frame := self.pad_tile(img, b.Min)
+		draw.Draw(self.image, frame.Bounds().Add(image.Pt(i%self.size*cell, i/self.size*cell)), frame, image.Point{}, draw.Src)
+		if b.Dy() > b.Dx() {
+			animation, err := self.load_animation(resources, name, i, img)
+			if err != nil {
+				return nil, err
+			}
+			self.animations = append(self.animations, animation)
+		}
+		self.tiles[strings.TrimSuffix(path.Base(name), ".png")] = i
+	}
+	return self, nil
+}
+
+func (self *Atlas) pad_tile(img image.Image, at image.Point) *image.RGBA {
+	/* Returns the tile in `img` with its top left corner `at` in the middle
+	   of a cell, with its edges stretched out over the border.
+
+	*/
+	cell := self.cell_size()
+	result := image.NewRGBA(image.Rect(0, 0, cell, cell))
+	for y := 0; y < cell; y++ {
+		sy := clamp(y-self.padding, 0, self.tile_size-1)
+		for x := 0; x < cell; x++ {
+			sx := clamp(x-self.padding, 0, self.tile_size-1)
+			result.Set(x, y, img.At(at.X+sx, at.Y+sy))
+		}
+	}
+	return result
+}
+
+func clamp(x, low, high int) int {
+	if x < low {
+		return low
+	}
+	if x > high {
+		return high
+	}
+	return x
+}
+
+func (self *Atlas) cell_size() int {
+	// Returns how many pixels wide each tile is with its border.
+
+	//
+	return self.tile_size + 2*self.padding
+}
+
+func (self *Atlas) mipmap_levels() int {
+	/* Returns how many times the atlas can be halved in size for mipmaps
+	   while every tile still has a border and the cells stay whole pixels.
+
+	*/
+	levels := 0
+	for p, cell := self.padding, self.cell_size(); p > 1 && cell%2 == 0; p, cell = p/2, cell/2 {
+		levels++
+	}
+	return levels
+}
+
+func (self *Atlas) tex_coord(name string) ([4]Point2f, bool) {
+	// Return the bounding vertices of the tile called `name`.
+
+	//
+	i, ok := self.tiles[name]
+	if !ok {
+		return [4]Point2f{}, false
+	}
+	w := float32(self.image.Bounds().Dx())
+	m := float32(self.tile_size) / w
+	dx := float32(i%self.size*self.cell_size()+self.padding) / w
+	// The image is flipped when it is loaded, so rows count up from the
+	// bottom.
+	dy := float32((self.size-1-i/self.size)*self.cell_size()+self.padding) / w
+	return [4]Point2f{{dx, dy}, {dx + m, dy}, {dx + m, dy + m}, {dx, dy + m}}, true
+}
+
+func (self *Atlas) save(file string) error {
+	// Write the atlas image to `file` as a PNG.
+
+	//
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, self.image); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sort"
 	"unsafe"
 
 	"github.com/go-gl/gl/v2.1/gl"
@@ -21,6 +22,20 @@ func cube_vertices(block Vertex, n float32) []Vertex {
 	}
 }
 
+func box_vertices(box Box) []Vertex {
+	// Return the vertices of `box`, in the same order as cube_vertices().
+
+	a, b := box.min, box.max
+	return []Vertex{
+		NewVertex(a.x, b.y, a.z), NewVertex(a.x, b.y, b.z), NewVertex(b.x, b.y, b.z), NewVertex(b.x, b.y, a.z), // top
+		NewVertex(a.x, a.y, a.z), NewVertex(b.x, a.y, a.z), NewVertex(b.x, a.y, b.z), NewVertex(a.x, a.y, b.z), // bottom
+		NewVertex(a.x, a.y, a.z), NewVertex(a.x, a.y, b.z), NewVertex(a.x, b.y, b.z), NewVertex(a.x, b.y, a.z), // left
+		NewVertex(b.x, a.y, b.z), NewVertex(b.x, a.y, a.z), NewVertex(b.x, b.y, a.z), NewVertex(b.x, b.y, b.z), // right
+		NewVertex(a.x, a.y, b.z), NewVertex(b.x, a.y, b.z), NewVertex(b.x, b.y, b.z), NewVertex(a.x, b.y, b.z), // front
+		NewVertex(b.x, a.y, a.z), NewVertex(a.x, a.y, a.z), NewVertex(a.x, b.y, a.z), NewVertex(b.x, b.y, a.z), // back
+	}
+}
+
 func drawPolygon(gl_mode uint32, vertex_data []Vertex) {
 	gl.Begin(gl_mode)
 	gl.Color3f(0.5, 0.5, 0.5)
@@ -38,6 +53,10 @@ type Point2f struct {
 	x, y float32
 }
 
+type Color struct {
+	r, g, b float32
+}
+
 func drawPoint2i(gl_mode uint32, cl []Point2i) {
 	gl.Begin(gl_mode)
 	gl.Color3f(0.5, 0.5, 0.5)
@@ -48,44 +67,87 @@ func drawPoint2i(gl_mode uint32, cl []Point2i) {
 }
 
 type Batch struct {
-	lists []CallList
+	lists map[uint32]CallList
+
+	// ids of all lists in the batch, rebuilt when lists are added or deleted.
+	id_list []uint32
+	dirty   bool
+
+	// How many vertices the lists draw between them.
+	vertices int
 }
 
 func NewBatch() *Batch {
-	return &Batch{lists: make([]CallList, 0, 10)}
+	return &Batch{lists: make(map[uint32]CallList)}
 }
 
-func (b *Batch) add(gl_mode uint32, vertex_data []Vertex, texture_data []Point2f) CallList {
-	bvl := NewCallList(b, gl_mode, vertex_data, texture_data)
-	b.lists = append(b.lists, bvl)
+func (b *Batch) add(position Vertex, gl_mode uint32, vertex_data []Vertex, texture_data []Point2f, color_data []Color) CallList {
+	bvl := NewCallList(b, position, gl_mode, vertex_data, texture_data, color_data)
+	b.lists[bvl.list_index] = bvl
+	b.dirty = true
+	b.vertices += bvl.vertices
 	return bvl
 }
 
 func (b *Batch) draw() {
 
-	num := int32(len(b.lists))
+	if b.dirty {
+		b.id_list = b.id_list[:0]
+		for list_index := range b.lists {
+			b.id_list = append(b.id_list, list_index)
+		}
+		b.dirty = false
+	}
 
-	id_list := make([]uint32, num, num)
-	for i, list := range b.lists {
-		id_list[i] = list.list_index
+	num := int32(len(b.id_list))
+	if num == 0 {
+		return
 	}
 
-	gl.CallLists(num, gl.UNSIGNED_INT, unsafe.Pointer(&id_list[0]))
+	gl.CallLists(num, gl.UNSIGNED_INT, unsafe.Pointer(&b.id_list[0]))
+}
+
+func (b *Batch) draw_sorted(eye Vertex) {
+	// Draw the lists from the one furthest from `eye` to the nearest.
+
+	//
+	lists := make([]CallList, 0, len(b.lists))
+	for _, list := range b.lists {
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		return
+	}
+	distance := func(v Vertex) float32 {
+		dx, dy, dz := v.x-eye.x, v.y-eye.y, v.z-eye.z
+		return dx*dx + dy*dy + dz*dz
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return distance(lists[i].position) > distance(lists[j].position)
+	})
+
+	id_list := make([]uint32, len(lists))
+	for i, list := range lists {
+		id_list[i] = list.list_index
+	}
+	gl.CallLists(int32(len(id_list)), gl.UNSIGNED_INT, unsafe.Pointer(&id_list[0]))
 }
 
 type CallList struct {
 	parent     *Batch
 	list_index uint32
+	position   Vertex
+	vertices   int
 }
 
 var last_bvl_id = 0
 
-func NewCallList(b *Batch, gl_mode uint32, vertex_data []Vertex, texture_data []Point2f) CallList {
-	bvl := CallList{parent: b}
+func NewCallList(b *Batch, position Vertex, gl_mode uint32, vertex_data []Vertex, texture_data []Point2f, color_data []Color) CallList {
+	bvl := CallList{parent: b, position: position, vertices: len(vertex_data)}
 
 	list_index := gl.GenLists(1)
 	gl.NewList(list_index, gl.COMPILE)
-	bvl.draw(gl_mode, vertex_data, texture_data)
+	bvl.draw(gl_mode, vertex_data, texture_data, color_data)
 	gl.EndList()
 
 	bvl.list_index = list_index
@@ -97,19 +159,18 @@ func (bvl CallList) delete() {
 	// free the structure, if necessary
 	// removes itself from the batch its part of as well.
 	b := bvl.parent
-	for i, bvl1 := range b.lists {
-		if bvl.list_index == bvl1.list_index {
-			b.lists = append(b.lists[:i], b.lists[i+1:]...)
-			return
-		}
-	}
+	delete(b.lists, bvl.list_index)
+	b.dirty = true
+	b.vertices -= bvl.vertices
 	gl.DeleteLists(bvl.list_index, 1)
 }
 
-func (bvl CallList) draw(gl_mode uint32, vl []Vertex, texture_data []Point2f) {
+func (bvl CallList) draw(gl_mode uint32, vl []Vertex, texture_data []Point2f, color_data []Color) {
 	gl.Begin(gl_mode)
 	for i, v := range vl {
 		t := texture_data[i]
+		c := color_data[i]
+		gl.Color3f(c.r, c.g, c.b)
 		gl.TexCoord2f(t.x, t.y)
 		gl.Vertex3f(v.x, v.y, v.z)
 	}
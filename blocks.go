@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	BLOCKS_PATH = "blocks.json"
+)
+
+// Names of the blocks the game itself places, when it generates the world
+// and when grass spreads or dies, which every set of blocks must define.
+var required_blocks = []string{"grass", "stone", "sand", "brick", "dirt"}
+
+// BlockID identifies a type of block in the world.
+type BlockID int
+
+// Render layers, drawn in this order.
+const (
+	// Solid blocks that hide whatever is behind them.
+	OPAQUE = iota
+	// Blocks with fully see-through holes in their texture, like glass.
+	CUTOUT
+	// Blocks that are partly see-through, like water. They are blended with
+	// whatever is behind them, so are drawn last and from back to front.
+	TRANSLUCENT
+)
+
+var layer_names = map[string]int{"opaque": OPAQUE, "cutout": CUTOUT, "translucent": TRANSLUCENT}
+
+// Names of the faces of a block, and their index in FACES.
+var face_names = map[string]int{"top": 0, "bottom": 1, "west": 2, "east": 3, "south": 4, "north": 5}
+
+// BlockDef describes one type of block.
+type BlockDef struct {
+	id   BlockID
+	name string
+	// Corners of the tile in the atlas drawn on each face, in the order of
+	// FACES.
+	textures []Point2f
+	// Whether the block is turned to face the player when it is placed.
+	// The textures are those of the block facing south.
+	directional bool
+	// Whether the player and falling blocks are stopped by it.
+	solid bool
+	// How the block is drawn, and whether it hides the faces behind it.
+	layer int
+	// Which of the shapes the block is, like CUBE or SLAB.
+	shape int
+	// How much light the block gives off.
+	light uint8
+	// How long the block takes to break.
+	hardness float32
+	// Points of health a second the player loses while in the block.
+	damage int
+	// Whether the player can't break the block at all.
+	unbreakable bool
+	// How the block flows, if it is a fluid.
+	fluid *Fluid
+	// What the block does when it is ticked.
+	behaviour BlockHandler
+	// If not 0, the block gets a scheduled tick this many ticks after it or
+	// a block next to it is added or removed.
+	update_delay int
+}
+
+// BlockRegistry holds every type of block, loaded from a definitions file.
+type BlockRegistry struct {
+	defs  map[BlockID]*BlockDef
+	names map[string]*BlockDef
+	// ids in the order they were defined.
+	ids []BlockID
+}
+
+// All the block types in the game.
+var blocks *BlockRegistry
+
+// blockDefFile is the layout of one block in the definitions file.
+type blockDefFile struct {
+	ID          *BlockID          `json:"id"`
+	Name        string            `json:"name"`
+	Textures    map[string]string `json:"textures"`
+	Directional bool              `json:"directional"`
+	Solid       bool              `json:"solid"`
+	Layer       string            `json:"layer"`
+	Shape       string            `json:"shape"`
+	Light       uint8             `json:"light"`
+	Hardness    float32           `json:"hardness"`
+	Damage      int               `json:"damage"`
+	// Whether the player can't break the block.
+	Unbreakable bool `json:"unbreakable"`
+	Fluid       *struct {
+		Reach int `json:"reach"`
+	} `json:"fluid"`
+	// Name of the behaviour in `behaviours` the block has.
+	Tick      string `json:"tick"`
+	TickDelay int    `json:"tick_delay"`
+}
+
+func load_blocks(resources *Resources, atlas *Atlas) (*BlockRegistry, error) {
+	/* Load the BLOCKS_PATH definitions file of `resources`, with tiles from
+	   `atlas`. The blocks a resource pack defines replace those with the
+	   same id, and any others are added.
+
+	*/
+	files, err := resources.read_all(BLOCKS_PATH)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &BlockRegistry{defs: make(map[BlockID]*BlockDef), names: make(map[string]*BlockDef)}
+	for _, file := range files {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(file.data, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.name, err)
+		}
+		// ids defined by this file, which it may not define twice.
+		defined := make(map[BlockID]bool)
+		for i, entry := range entries {
+			// Fields missing from the file keep these defaults.
+			f := blockDefFile{Solid: true, Layer: "opaque", Shape: "cube"}
+			if err := json.Unmarshal(entry, &f); err != nil {
+				return nil, fmt.Errorf("%s: block %d: %v", file.name, i, err)
+			}
+			def, err := f.def(atlas)
+			if err != nil {
+				return nil, fmt.Errorf("%s: block %d %q: %v", file.name, i, f.Name, err)
+			}
+			if defined[def.id] {
+				return nil, fmt.Errorf("%s: block %q: id %d is already used by %q", file.name, def.name, def.id, self.defs[def.id].name)
+			}
+			defined[def.id] = true
+			if old, ok := self.defs[def.id]; ok {
+				delete(self.names, old.name)
+			} else {
+				self.ids = append(self.ids, def.id)
+			}
+			if other, ok := self.names[def.name]; ok {
+				return nil, fmt.Errorf("%s: block %d: name %q is already used by block %d", file.name, def.id, def.name, other.id)
+			}
+			self.defs[def.id] = def
+			self.names[def.name] = def
+		}
+	}
+	for _, name := range required_blocks {
+		if _, ok := self.names[name]; !ok {
+			return nil, fmt.Errorf("%s: block %q is not defined", BLOCKS_PATH, name)
+		}
+	}
+	return self, nil
+}
+
+func (f blockDefFile) def(atlas *Atlas) (*BlockDef, error) {
+	if f.ID == nil {
+		return nil, fmt.Errorf("missing id")
+	}
+	if f.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	def := &BlockDef{
+		id:           *f.ID,
+		name:         f.Name,
+		solid:        f.Solid,
+		light:        f.Light,
+		hardness:     f.Hardness,
+		damage:       f.Damage,
+		unbreakable:  f.Unbreakable,
+		directional:  f.Directional,
+		update_delay: f.TickDelay,
+	}
+
+	layer, ok := layer_names[f.Layer]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer %q", f.Layer)
+	}
+	def.layer = layer
+
+	shape, ok := shape_names[f.Shape]
+	if !ok {
+		return nil, fmt.Errorf("unknown shape %q", f.Shape)
+	}
+	def.shape = shape
+	if f.Fluid != nil && shape != CUBE {
+		return nil, fmt.Errorf("fluids must be cubes")
+	}
+
+	if f.Light > MAX_LIGHT {
+		return nil, fmt.Errorf("light %d is brighter than %d", f.Light, MAX_LIGHT)
+	}
+
+	// Each face's texture is looked up by the face's name, then "side" for
+	// the four sides, then "all".
+	for name := range f.Textures {
+		if _, ok := face_names[name]; !ok && name != "side" && name != "all" {
+			return nil, fmt.Errorf("unknown face %q", name)
+		}
+	}
+	def.textures = make([]Point2f, 4*len(FACES))
+	for name, i := range face_names {
+		names := []string{name, "all"}
+		if FACES[i].y == 0 {
+			names = []string{name, "side", "all"}
+		}
+		found := false
+		for _, n := range names {
+			if tile, ok := f.Textures[n]; ok {
+				square, ok := atlas.tex_coord(tile)
+				if !ok {
+					return nil, fmt.Errorf("%s texture: no tile called %q", n, tile)
+				}
+				copy(def.textures[i*4:i*4+4], square[:])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("missing %s texture", name)
+		}
+	}
+
+	if f.Fluid != nil {
+		def.fluid = &Fluid{reach: f.Fluid.Reach}
+	}
+	if f.Tick != "" {
+		behaviour, ok := behaviours[f.Tick]
+		if !ok {
+			return nil, fmt.Errorf("unknown tick behaviour %q", f.Tick)
+		}
+		def.behaviour = behaviour
+	}
+	return def, nil
+}
+
+func (self *BlockDef) opaque() bool {
+	// Returns true if the block hides the faces behind it and stops light.
+
+	//
+	return self.layer == OPAQUE && self.shape == CUBE
+}
+
+func (self *BlockRegistry) get(id BlockID) *BlockDef {
+	return self.defs[id]
+}
+
+func (self *BlockRegistry) named(name string) *BlockDef {
+	return self.names[name]
+}
+
+func (self *BlockRegistry) id(name string) BlockID {
+	/* Returns the id of the block type called `name`. Used for the blocks
+	   the game itself places, which load_blocks() makes sure are defined,
+	   so `name` must be one of required_blocks.
+
+	*/
+	def, ok := self.names[name]
+	if !ok {
+		panic(fmt.Sprintf("block %q is not defined", name))
+	}
+	return def.id
+}
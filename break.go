@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v2.1/gl"
+)
+
+const (
+	// How many seconds holding the mouse button down takes to break a
+	// block, for each point of its hardness.
+	BREAK_TIME = 1.5
+
+	// How many crack tiles, destroy_0 to destroy_9, show how far a block
+	// is broken.
+	DESTROY_STAGES = 10
+)
+
+func (self *Window) start_breaking() {
+	// Start breaking the block under the crosshairs while the left mouse
+	// button is held down.
+
+	//
+	self.breaking = true
+	self.break_target = nilVertex
+	self.break_progress = 0
+}
+
+func (self *Window) stop_breaking() {
+	// Stop breaking, losing the progress made on the block.
+
+	//
+	self.breaking = false
+	self.break_target = nilVertex
+	self.break_progress = 0
+}
+
+func (self *Window) update_breaking(dt float32) {
+	/* Break the block under the crosshairs a bit more, starting again on
+	   whatever is under the crosshairs if it has changed.
+
+	   Parameters
+	   ----------
+	   dt : float
+	       The change in time since the last call.
+
+	*/
+	if !self.breaking {
+		return
+	}
+	block, _ := self.model.hit_test(self.position, self.get_sight_vector(), 8)
+	if block != self.break_target {
+		self.break_target = block
+		self.break_progress = 0
+	}
+	if block.isNil() {
+		return
+	}
+	def := blocks.get(self.model.world[block])
+	if def.unbreakable {
+		return
+	}
+	if def.hardness > 0 {
+		self.break_progress += dt / (def.hardness * BREAK_TIME)
+	}
+	if def.hardness <= 0 || self.break_progress >= 1 {
+		self.break_block(block)
+		self.break_target = nilVertex
+		self.break_progress = 0
+	}
+}
+
+func (self *Window) break_block(position Vertex) {
+	/* Remove the block at `position`, unless it can't be broken. In
+	   survival mode the player gets it.
+
+	*/
+	def := blocks.get(self.model.world[position])
+	if def.unbreakable {
+		return
+	}
+	self.model.remove_block(position)
+	if self.mode == SURVIVAL {
+		// Blocks that don't fit are lost.
+		self.inventory.add(ItemID(def.id), 1)
+	}
+}
+
+func (self *Window) draw_cracks() {
+	/* Draw cracks over the block being broken, more of them the further
+	   it is broken.
+
+	*/
+	if self.break_target.isNil() || self.break_progress <= 0 {
+		return
+	}
+	stage := clamp(int(self.break_progress*DESTROY_STAGES), 0, DESTROY_STAGES-1)
+	square, ok := self.atlas.tex_coord(fmt.Sprintf("destroy_%d", stage))
+	if !ok {
+		return
+	}
+	cube := cube_vertices(self.break_target, 0.5)
+
+	gl.BindTexture(gl.TEXTURE_2D, self.texture)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	// Pull the cracks just in front of the faces they are drawn on.
+	gl.Enable(gl.POLYGON_OFFSET_FILL)
+	gl.PolygonOffset(-1, -1)
+	gl.DepthMask(false)
+	gl.Color3f(1, 1, 1)
+	gl.Begin(gl.QUADS)
+	for _, box := range self.model.boxes(self.break_target) {
+		box_data := box_vertices(box)
+		for i := range FACES {
+			face := box_data[i*4 : i*4+4]
+			tex := crop_texture(cube[i*4:i*4+4], square[:], face)
+			for j, v := range face {
+				gl.TexCoord2f(tex[j].x, tex[j].y)
+				gl.Vertex3f(v.x, v.y, v.z)
+			}
+		}
+	}
+	gl.End()
+	gl.DepthMask(true)
+	gl.Disable(gl.POLYGON_OFFSET_FILL)
+	gl.Disable(gl.BLEND)
+}
@@ -0,0 +1,191 @@
+package main
+
+const (
+	// Boxes closer than this count as touching rather than overlapping, so
+	// rounding errors don't catch the player on the block they stand on.
+	COLLISION_EPSILON = 1e-4
+
+	// How high a ledge, like a slab or a stair, the player walks up onto
+	// without jumping.
+	STEP_HEIGHT = 0.5
+)
+
+func NewEntityBox(eye Vertex, width, height, eye_height float32) Box {
+	/* Returns the box taken up by an entity `width` blocks across and
+	   `height` blocks high, with its eyes at `eye`, `eye_height` above its
+	   feet.
+
+	*/
+	r := width / 2
+	feet := eye.y - eye_height
+	return NewBox(eye.x-r, feet, eye.z-r, eye.x+r, feet+height, eye.z+r)
+}
+
+func (self Box) stretch(v Vertex) Box {
+	// Returns the box covering this box as it is moved along `v`.
+
+	//
+	result := self
+	for _, i := range xrange(0, 3, 1) {
+		if d := v.get(i); d < 0 {
+			result.min.set(i, result.min.get(i)+d)
+		} else {
+			result.max.set(i, result.max.get(i)+d)
+		}
+	}
+	return result
+}
+
+func (self Box) cells() []Vertex {
+	// Returns the position of every block the box overlaps, not counting
+	// those it only touches.
+
+	//
+	e := NewVertex(COLLISION_EPSILON, COLLISION_EPSILON, COLLISION_EPSILON)
+	lo, hi := normalize(self.min.add(e)), normalize(self.max.sub(e))
+	result := []Vertex{}
+	for x := lo.x; x <= hi.x; x++ {
+		for y := lo.y; y <= hi.y; y++ {
+			for z := lo.z; z <= hi.z; z++ {
+				result = append(result, NewVertex(x, y, z))
+			}
+		}
+	}
+	return result
+}
+
+func (self *Model) colliders(region Box) []Box {
+	// Returns the boxes of the solid blocks that overlap `region`.
+
+	//
+	result := []Box{}
+	for _, position := range region.cells() {
+		if texture, ok := self.world[position]; ok && blocks.get(texture).solid {
+			for _, box := range self.boxes(position) {
+				if box.intersects(region) {
+					result = append(result, box)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func clip_motion(box Box, others []Box, axis int, d float32) float32 {
+	/* Returns how far `box` can move along `axis`, up to `d`, before it
+	   hits any of `others`. Boxes it already overlaps don't stop it, so
+	   it can always get out of them.
+
+	*/
+	for _, other := range others {
+		overlaps := true
+		for _, i := range xrange(0, 3, 1) {
+			if i != axis && (box.max.get(i)-other.min.get(i) <= COLLISION_EPSILON || other.max.get(i)-box.min.get(i) <= COLLISION_EPSILON) {
+				overlaps = false
+			}
+		}
+		if !overlaps {
+			continue
+		}
+		if gap := other.min.get(axis) - box.max.get(axis); d > 0 && gap >= -COLLISION_EPSILON {
+			d = min(d, max(gap, 0))
+		} else if gap := other.max.get(axis) - box.min.get(axis); d < 0 && gap <= COLLISION_EPSILON {
+			d = max(d, min(gap, 0))
+		}
+	}
+	return d
+}
+
+func sweep(box Box, others []Box, motion Vertex) (Vertex, [3]bool) {
+	/* Move `box` along `motion` one axis at a time, up first, stopping it
+	   against `others`. Returns how far it moved, and along which axes it
+	   was stopped.
+
+	*/
+	var moved Vertex
+	var blocked [3]bool
+	for _, axis := range []int{1, 0, 2} {
+		d := motion.get(axis)
+		if d == 0 {
+			continue
+		}
+		clipped := clip_motion(box, others, axis, d)
+		blocked[axis] = clipped != d
+		moved.set(axis, clipped)
+		var step Vertex
+		step.set(axis, clipped)
+		box = box.translate(step)
+	}
+	return moved, blocked
+}
+
+func (self *Model) move_box(box Box, motion Vertex, step_height float32) (Vertex, [3]bool) {
+	/* Move an entity taking up `box` along `motion` through the world,
+	   stopping it against solid blocks.
+
+	   Parameters
+	   ----------
+	   box : Box
+	       The space the entity takes up.
+	   motion : Vertex
+	       How far it is trying to move.
+	   step_height : float
+	       How high a ledge it climbs onto when it walks into one, or 0 if
+	       it can't, like when it isn't standing on the ground.
+
+	   Returns
+	   -------
+	   moved : Vertex
+	       How far it moved.
+	   blocked : list of len 3
+	       Whether a block stopped it along each axis. It is on the ground
+	       if it was stopped while moving down.
+
+	*/
+	others := self.colliders(box.stretch(motion).stretch(NewVertex(0, step_height, 0)))
+	moved, blocked := sweep(box, others, motion)
+	if step_height <= 0 || (!blocked[0] && !blocked[2]) {
+		return moved, blocked
+	}
+
+	// Try again from higher up, then come back down onto whatever it
+	// stepped onto.
+	up, _ := sweep(box, others, NewVertex(0, step_height, 0))
+	raised := box.translate(up)
+	across, stepped := sweep(raised, others, NewVertex(motion.x, 0, motion.z))
+	down, landed := sweep(raised.translate(across), others, NewVertex(0, -up.y, 0))
+	if across.x*across.x+across.z*across.z <= moved.x*moved.x+moved.z*moved.z {
+		return moved, blocked
+	}
+	stepped[1] = landed[1]
+	return up.add(across).add(down), stepped
+}
+
+func (self *Window) body() Box {
+	// Returns the box the player takes up.
+
+	//
+	return NewEntityBox(self.position, PLAYER_WIDTH, PLAYER_HEIGHT, PLAYER_EYE_HEIGHT)
+}
+
+func (self *Window) move(motion Vertex) {
+	/* Move the player along `motion`, stopping them against the blocks in
+	   the way and climbing onto low ledges while they walk.
+
+	*/
+	step := float32(0)
+	if self.on_ground && !self.flying {
+		step = STEP_HEIGHT
+	}
+	moved, blocked := self.model.move_box(self.body(), motion, step)
+	self.position = self.position.add(moved)
+	self.on_ground = blocked[1] && motion.y < 0
+	if blocked[1] {
+		if self.on_ground {
+			self.land(-self.dy)
+		}
+		// You are colliding with the ground or ceiling, so stop falling /
+		// rising.
+		self.dy = 0
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Console reads commands typed into the terminal the game was started from.
+// Lines are read in the background and run on the main thread by update().
+type Console struct {
+	lines chan string
+}
+
+// A Command runs a console command with the words typed after its name.
+type Command func(window *Window, args []string) error
+
+var commands = map[string]Command{
+	"time":     command_time,
+	"filter":   command_filter,
+	"gamemode": command_gamemode,
+	"spawn":    command_spawn,
+}
+
+func NewConsole() *Console {
+	self := &Console{lines: make(chan string, 16)}
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			self.lines <- scanner.Text()
+		}
+	}()
+	return self
+}
+
+func (self *Console) update(window *Window) {
+	// Run every command that has been typed since the last call.
+
+	//
+	for {
+		select {
+		case line := <-self.lines:
+			if err := run_command(window, line); err != nil {
+				fmt.Println(err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func run_command(window *Window, line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return command(window, args[1:])
+}
+
+var named_times = map[string]float64{"sunrise": SUNRISE, "day": SUNRISE, "noon": NOON, "sunset": SUNSET, "night": SUNSET, "midnight": MIDNIGHT}
+
+func command_time(window *Window, args []string) error {
+	/* Show or change the time of day.
+
+	   time                 print the current time
+	   time set <ticks>     set the time, or one of sunrise, day, noon,
+	                        sunset, night or midnight
+	   time add <ticks>     move the time forward
+
+	*/
+	model := window.model
+	if len(args) == 0 {
+		fmt.Printf("time is %d (day %d, %d ticks in)\n", int64(model.time), int64(model.time)/DAY_LENGTH, int64(time_of_day(model.time)*DAY_LENGTH))
+		return nil
+	}
+	if len(args) != 2 || (args[0] != "set" && args[0] != "add") {
+		return fmt.Errorf("usage: time [set|add <ticks>]")
+	}
+	ticks, ok := named_times[args[1]]
+	if !ok {
+		var err error
+		if ticks, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return fmt.Errorf("time: %q is not a number of ticks", args[1])
+		}
+	}
+	if args[0] == "set" {
+		if _, named := named_times[args[1]]; named {
+			// Move to that time on the current day.
+			ticks += model.time - time_of_day(model.time)*DAY_LENGTH
+		}
+		model.set_time(ticks)
+	} else {
+		model.advance_time(ticks)
+	}
+	return nil
+}
+
+func command_filter(window *Window, args []string) error {
+	/* Show or change how block textures are filtered.
+
+	   filter               print the current filter
+	   filter <name>        use nearest, linear or anisotropic filtering
+
+	*/
+	if len(args) == 0 {
+		fmt.Printf("filter is %s\n", filter_names[settings.texture_filter])
+		return nil
+	}
+	for filter, name := range filter_names {
+		if len(args) == 1 && args[0] == name {
+			settings.texture_filter = filter
+			set_texture_filter(window.texture)
+			return nil
+		}
+	}
+	return fmt.Errorf("usage: filter [%s]", strings.Join(filter_names, "|"))
+}
+
+func command_gamemode(window *Window, args []string) error {
+	/* Show or change the player's game mode.
+
+	   gamemode             print the current game mode
+	   gamemode <name>      play in creative, survival or spectator mode
+
+	*/
+	if len(args) == 0 {
+		fmt.Printf("game mode is %s\n", mode_names[window.mode])
+		return nil
+	}
+	if mode, ok := mode_named(args[0]); ok && len(args) == 1 {
+		window.set_mode(mode)
+		return nil
+	}
+	return fmt.Errorf("usage: gamemode [%s]", strings.Join(mode_names, "|"))
+}
+
+func command_spawn(window *Window, args []string) error {
+	/* Show or move the world's spawn point, where players start and come
+	   back to life.
+
+	   spawn                print the spawn point
+	   spawn set            move it to where the player is
+
+	*/
+	model := window.model
+	if len(args) == 0 {
+		fmt.Printf("spawn is %.1f %.1f %.1f\n", model.spawn.x, model.spawn.y, model.spawn.z)
+		return nil
+	}
+	if len(args) != 1 || args[0] != "set" {
+		return fmt.Errorf("usage: spawn [set]")
+	}
+	model.spawn = window.position
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	RECIPES_PATH = "recipes.json"
+
+	// How many slots wide and high the crafting grid is.
+	CRAFTING_SIZE = 3
+
+	// Marks an empty slot in the pattern of a shaped recipe.
+	NO_ITEM ItemID = -1
+)
+
+// Recipe turns the items in the crafting grid into a stack of another.
+type Recipe struct {
+	// For a shaped recipe, the items in the smallest rectangle of the
+	// grid holding them, row by row from the top. It may also be crafted
+	// mirrored left to right.
+	width, height int
+	pattern       []ItemID
+	// For a shapeless recipe, the items that may be in any of the slots.
+	ingredients []ItemID
+	result      ItemStack
+}
+
+// All the recipes in the game.
+var recipes []*Recipe
+
+// recipeFile is the layout of one recipe in the recipes file. A shaped
+// recipe has a pattern with a character for each slot, a space where
+// the slot is empty, and a key naming the item each character stands for.
+// A shapeless recipe lists its ingredients.
+type recipeFile struct {
+	Pattern     []string          `json:"pattern"`
+	Key         map[string]string `json:"key"`
+	Ingredients []string          `json:"ingredients"`
+	Result      string            `json:"result"`
+	Count       int               `json:"count"`
+}
+
+func load_recipes(resources *Resources, registry *ItemRegistry) ([]*Recipe, error) {
+	/* Load the recipes in every RECIPES_PATH file of `resources`, a
+	   resource pack's as well as the game's own, checking that they only
+	   use the items in `registry`.
+
+	*/
+	files, err := resources.read_all(RECIPES_PATH)
+	if err != nil {
+		return nil, err
+	}
+	result := []*Recipe{}
+	for _, file := range files {
+		var entries []recipeFile
+		if err := json.Unmarshal(file.data, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.name, err)
+		}
+		for i, f := range entries {
+			recipe, err := f.recipe(registry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: recipe %d (%s): %v", file.name, i, f.Result, err)
+			}
+			result = append(result, recipe)
+		}
+	}
+	return result, nil
+}
+
+func (f recipeFile) recipe(registry *ItemRegistry) (*Recipe, error) {
+	if f.Result == "" {
+		return nil, fmt.Errorf("missing result")
+	}
+	result := registry.named(f.Result)
+	if result == nil {
+		return nil, fmt.Errorf("result: no item called %q", f.Result)
+	}
+	if f.Count == 0 {
+		f.Count = 1
+	}
+	if f.Count < 0 || f.Count > MAX_STACK {
+		return nil, fmt.Errorf("count %d is not between 1 and %d", f.Count, MAX_STACK)
+	}
+	self := &Recipe{result: ItemStack{result.id, f.Count}}
+
+	if (f.Pattern == nil) == (f.Ingredients == nil) {
+		return nil, fmt.Errorf("needs either a pattern or ingredients")
+	}
+	if f.Ingredients != nil {
+		if len(f.Ingredients) == 0 || len(f.Ingredients) > CRAFTING_SIZE*CRAFTING_SIZE {
+			return nil, fmt.Errorf("%d ingredients, not between 1 and %d", len(f.Ingredients), CRAFTING_SIZE*CRAFTING_SIZE)
+		}
+		for _, name := range f.Ingredients {
+			item := registry.named(name)
+			if item == nil {
+				return nil, fmt.Errorf("ingredients: no item called %q", name)
+			}
+			self.ingredients = append(self.ingredients, item.id)
+		}
+		return self, nil
+	}
+
+	keys := make(map[rune]ItemID)
+	for k, name := range f.Key {
+		runes := []rune(k)
+		if len(runes) != 1 || runes[0] == ' ' {
+			return nil, fmt.Errorf("key %q must be one character other than a space", k)
+		}
+		item := registry.named(name)
+		if item == nil {
+			return nil, fmt.Errorf("key %q: no item called %q", k, name)
+		}
+		keys[runes[0]] = item.id
+	}
+	self.height = len(f.Pattern)
+	if self.height == 0 || self.height > CRAFTING_SIZE {
+		return nil, fmt.Errorf("pattern has %d rows, not between 1 and %d", self.height, CRAFTING_SIZE)
+	}
+	self.width = len([]rune(f.Pattern[0]))
+	if self.width == 0 || self.width > CRAFTING_SIZE {
+		return nil, fmt.Errorf("pattern is %d wide, not between 1 and %d", self.width, CRAFTING_SIZE)
+	}
+	used := make(map[rune]bool)
+	for y, row := range f.Pattern {
+		if len([]rune(row)) != self.width {
+			return nil, fmt.Errorf("pattern row %d is %d wide, not %d like the first", y, len([]rune(row)), self.width)
+		}
+		for _, c := range row {
+			if c == ' ' {
+				self.pattern = append(self.pattern, NO_ITEM)
+				continue
+			}
+			id, ok := keys[c]
+			if !ok {
+				return nil, fmt.Errorf("pattern row %d: %q is not in the key", y, c)
+			}
+			used[c] = true
+			self.pattern = append(self.pattern, id)
+		}
+	}
+	for c := range keys {
+		if !used[c] {
+			return nil, fmt.Errorf("key %q is not used in the pattern", c)
+		}
+	}
+	// Patterns are matched against the smallest rectangle holding the
+	// items in the grid, so one with empty edges would never match.
+	top, bottom := strings.TrimSpace(f.Pattern[0]), strings.TrimSpace(f.Pattern[self.height-1])
+	left, right := true, true
+	for y := range xrange(0, self.height, 1) {
+		left = left && self.pattern[y*self.width] == NO_ITEM
+		right = right && self.pattern[y*self.width+self.width-1] == NO_ITEM
+	}
+	if top == "" || bottom == "" || left || right {
+		return nil, fmt.Errorf("pattern has an empty row or column at its edge")
+	}
+	return self, nil
+}
+
+func (self *Recipe) matches(grid []ItemStack) bool {
+	/* Returns true if the items in `grid`, the CRAFTING_SIZE by
+	   CRAFTING_SIZE slots of the crafting grid row by row from the top,
+	   make this recipe.
+
+	*/
+	if self.ingredients != nil {
+		needed := make(map[ItemID]int)
+		for _, id := range self.ingredients {
+			needed[id]++
+		}
+		for _, s := range grid {
+			if !s.empty() {
+				needed[s.item]--
+			}
+		}
+		for _, n := range needed {
+			if n != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// The smallest rectangle of the grid with all the items in it.
+	x0, y0, x1, y1 := CRAFTING_SIZE, CRAFTING_SIZE, -1, -1
+	for i, s := range grid {
+		if !s.empty() {
+			x, y := i%CRAFTING_SIZE, i/CRAFTING_SIZE
+			if x < x0 {
+				x0 = x
+			}
+			if x > x1 {
+				x1 = x
+			}
+			if y < y0 {
+				y0 = y
+			}
+			if y > y1 {
+				y1 = y
+			}
+		}
+	}
+	if x1-x0+1 != self.width || y1-y0+1 != self.height {
+		return false
+	}
+	for _, mirrored := range []bool{false, true} {
+		found := true
+		for y := range xrange(0, self.height, 1) {
+			for x := range xrange(0, self.width, 1) {
+				px := x
+				if mirrored {
+					px = self.width - 1 - x
+				}
+				s := grid[(y0+y)*CRAFTING_SIZE+x0+x]
+				want := self.pattern[y*self.width+px]
+				if (want == NO_ITEM) != s.empty() || (!s.empty() && s.item != want) {
+					found = false
+				}
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func find_recipe(book []*Recipe, grid []ItemStack) *Recipe {
+	// Returns the first recipe in `book` the items in `grid` make, or nil.
+
+	//
+	for _, recipe := range book {
+		if recipe.matches(grid) {
+			return recipe
+		}
+	}
+	return nil
+}
+
+func craft(book []*Recipe, grid []ItemStack) (ItemStack, bool) {
+	/* Use up one item from each slot of `grid` to make the recipe in
+	   `book` they make. Returns false, and leaves the grid alone, if they
+	   don't make any.
+
+	*/
+	recipe := find_recipe(book, grid)
+	if recipe == nil {
+		return ItemStack{}, false
+	}
+	for i := range grid {
+		if !grid[i].empty() {
+			grid[i].count--
+			if grid[i].empty() {
+				grid[i] = ItemStack{}
+			}
+		}
+	}
+	return recipe.result, true
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// test_blocks returns a registry of a few blocks, without any textures.
+func test_blocks() *BlockRegistry {
+	registry := &BlockRegistry{defs: make(map[BlockID]*BlockDef), names: make(map[string]*BlockDef)}
+	for i, name := range []string{"log", "planks", "dirt", "gravel", "grass"} {
+		def := &BlockDef{id: BlockID(i + 1), name: name}
+		registry.defs[def.id] = def
+		registry.names[def.name] = def
+		registry.ids = append(registry.ids, def.id)
+	}
+	return registry
+}
+
+// test_atlas returns an atlas of one empty tile called "stick".
+func test_atlas() *Atlas {
+	return &Atlas{image: image.NewRGBA(image.Rect(0, 0, 16, 16)), size: 1, tile_size: 16, tiles: map[string]int{"stick": 0}}
+}
+
+// test_resources returns resources holding just `files`, by name.
+func test_resources(files map[string]string) *Resources {
+	layer := fstest.MapFS{}
+	for name, data := range files {
+		layer[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return &Resources{layers: []fs.FS{layer}, names: []string{"test"}}
+}
+
+func test_items(t *testing.T) *ItemRegistry {
+	resources := test_resources(map[string]string{ITEMS_PATH: `[{"id": 256, "name": "stick", "texture": "stick"}]`})
+	registry, err := load_items(resources, test_atlas(), test_blocks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func test_recipe(t *testing.T, registry *ItemRegistry, data string) *Recipe {
+	var f recipeFile
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		t.Fatal(err)
+	}
+	recipe, err := f.recipe(registry)
+	if err != nil {
+		t.Fatalf("%s: %v", data, err)
+	}
+	return recipe
+}
+
+// test_grid returns a crafting grid holding one of each item named in
+// `rows`, from the top. Empty names are empty slots.
+func test_grid(registry *ItemRegistry, rows ...[CRAFTING_SIZE]string) []ItemStack {
+	grid := make([]ItemStack, CRAFTING_SIZE*CRAFTING_SIZE)
+	for y, row := range rows {
+		for x, name := range row {
+			if name != "" {
+				grid[y*CRAFTING_SIZE+x] = ItemStack{registry.named(name).id, 1}
+			}
+		}
+	}
+	return grid
+}
+
+func TestShapedRecipe(t *testing.T) {
+	registry := test_items(t)
+	stairs := test_recipe(t, registry, `{"pattern": ["# ", "##"], "key": {"#": "planks"}, "result": "log"}`)
+	if stairs.width != 2 || stairs.height != 2 {
+		t.Fatalf("pattern is %dx%d, want 2x2", stairs.width, stairs.height)
+	}
+	for _, c := range []struct {
+		name string
+		grid []ItemStack
+		want bool
+	}{
+		{"top left", test_grid(registry, [3]string{"planks", "", ""}, [3]string{"planks", "planks", ""}), true},
+		{"off centre", test_grid(registry, [3]string{}, [3]string{"", "planks", ""}, [3]string{"", "planks", "planks"}), true},
+		{"mirrored", test_grid(registry, [3]string{"", "", "planks"}, [3]string{"", "planks", "planks"}), true},
+		{"upside down", test_grid(registry, [3]string{"planks", "planks", ""}, [3]string{"planks", "", ""}), false},
+		{"wrong item", test_grid(registry, [3]string{"planks", "", ""}, [3]string{"planks", "log", ""}), false},
+		{"extra item", test_grid(registry, [3]string{"planks", "", ""}, [3]string{"planks", "planks", ""}, [3]string{"", "", "dirt"}), false},
+		{"empty", test_grid(registry), false},
+	} {
+		if got := stairs.matches(c.grid); got != c.want {
+			t.Errorf("%s: matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestShapelessRecipe(t *testing.T) {
+	registry := test_items(t)
+	grass := test_recipe(t, registry, `{"ingredients": ["dirt", "gravel", "dirt"], "result": "grass"}`)
+	for _, c := range []struct {
+		name string
+		grid []ItemStack
+		want bool
+	}{
+		{"in order", test_grid(registry, [3]string{"dirt", "gravel", "dirt"}), true},
+		{"scattered", test_grid(registry, [3]string{"", "dirt"}, [3]string{"gravel"}, [3]string{"", "", "dirt"}), true},
+		{"missing", test_grid(registry, [3]string{"dirt", "gravel"}), false},
+		{"extra", test_grid(registry, [3]string{"dirt", "gravel", "dirt"}, [3]string{"log"}), false},
+		{"wrong item", test_grid(registry, [3]string{"dirt", "gravel", "gravel"}), false},
+	} {
+		if got := grass.matches(c.grid); got != c.want {
+			t.Errorf("%s: matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCraft(t *testing.T) {
+	registry := test_items(t)
+	book := []*Recipe{
+		test_recipe(t, registry, `{"ingredients": ["log"], "result": "planks", "count": 4}`),
+		test_recipe(t, registry, `{"pattern": ["P", "P"], "key": {"P": "planks"}, "result": "stick", "count": 4}`),
+	}
+
+	grid := test_grid(registry, [3]string{}, [3]string{"", "", "planks"}, [3]string{"", "", "planks"})
+	grid[5].count = 3
+	if recipe := find_recipe(book, grid); recipe != book[1] {
+		t.Fatalf("found %v, want the stick recipe", recipe)
+	}
+	result, ok := craft(book, grid)
+	if !ok || result != (ItemStack{registry.named("stick").id, 4}) {
+		t.Fatalf("crafted %v, %v, want 4 sticks", result, ok)
+	}
+	// One item is used up from each slot.
+	if grid[5] != (ItemStack{registry.named("planks").id, 2}) || grid[8] != (ItemStack{}) {
+		t.Fatalf("grid after crafting is %v", grid)
+	}
+
+	// Nothing changes when there is no recipe.
+	grid = test_grid(registry, [3]string{"dirt"})
+	if _, ok := craft(book, grid); ok || grid[0].empty() {
+		t.Fatalf("crafted from %v", grid)
+	}
+}
+
+func TestRecipeErrors(t *testing.T) {
+	registry := test_items(t)
+	for _, c := range []struct {
+		data, want string
+	}{
+		{`{"ingredients": ["log"]}`, "missing result"},
+		{`{"ingredients": ["wood"], "result": "planks"}`, `ingredients: no item called "wood"`},
+		{`{"ingredients": ["log"], "result": "plank"}`, `result: no item called "plank"`},
+		{`{"pattern": ["#"], "key": {"#": "wood"}, "result": "stick"}`, `key "#": no item called "wood"`},
+		{`{"pattern": ["#"], "key": {"#": "planks", "Y": "log"}, "result": "stick"}`, `key 'Y' is not used in the pattern`},
+		{`{"pattern": ["#X"], "key": {"#": "planks"}, "result": "stick"}`, `'X' is not in the key`},
+		{`{"pattern": ["##", "#"], "key": {"#": "planks"}, "result": "stick"}`, "pattern row 1 is 1 wide, not 2"},
+		{`{"pattern": [" #", " #"], "key": {"#": "planks"}, "result": "stick"}`, "empty row or column"},
+		{`{"pattern": ["# ", "# "], "key": {"#": "planks"}, "result": "stick"}`, "empty row or column"},
+		{`{"pattern": ["  ", "##"], "key": {"#": "planks"}, "result": "stick"}`, "empty row or column"},
+		{`{"pattern": ["####"], "key": {"#": "planks"}, "result": "stick"}`, "pattern is 4 wide"},
+		{`{"pattern": ["#"], "ingredients": ["log"], "key": {"#": "planks"}, "result": "stick"}`, "either a pattern or ingredients"},
+		{`{"ingredients": ["log"], "result": "stick", "count": 65}`, "count 65 is not between 1 and 64"},
+		{`{"ingredients": ["log"], "result": "stick", "count": -1}`, "count -1"},
+	} {
+		var f recipeFile
+		if err := json.Unmarshal([]byte(c.data), &f); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.recipe(registry); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.data, err, c.want)
+		}
+	}
+
+	// Errors say which file and recipe they are in.
+	resources := test_resources(map[string]string{RECIPES_PATH: `[{"ingredients": ["log"], "result": "planks"}, {"ingredients": ["wood"], "result": "stick"}]`})
+	_, err := load_recipes(resources, registry)
+	if err == nil || !strings.HasPrefix(err.Error(), "test/recipes.json: recipe 1 (stick): ") {
+		t.Errorf("got error %v, want it to name the file and recipe", err)
+	}
+}
+
+func TestLoadItems(t *testing.T) {
+	registry := test_items(t)
+	if log := registry.named("log"); log == nil || log.block == nil || log.id != 1 {
+		t.Fatalf("block item is %v", log)
+	}
+	if stick := registry.named("stick"); stick == nil || stick.block != nil || stick.id != 256 {
+		t.Fatalf("stick is %v", stick)
+	}
+
+	for _, c := range []struct {
+		data, want string
+	}{
+		{`[{"name": "stick", "texture": "stick"}]`, "missing id"},
+		{`[{"id": 256, "texture": "stick"}]`, "missing name"},
+		{`[{"id": 2, "name": "stick", "texture": "stick"}]`, `id 2 is already used by block "planks"`},
+		{`[{"id": 256, "name": "stick", "texture": "stick"}, {"id": 256, "name": "twig", "texture": "stick"}]`, `id 256 is already used by "stick"`},
+		{`[{"id": 256, "name": "log", "texture": "stick"}]`, `name "log" is already used by 1`},
+		{`[{"id": 256, "name": "stick", "texture": "twig"}]`, `no tile called "twig"`},
+		{`[{"id": 256, "name": "stick", "texture": "stick", "food": 21}]`, "food 21 is not between 0 and 20"},
+	} {
+		resources := test_resources(map[string]string{ITEMS_PATH: c.data})
+		if _, err := load_items(resources, test_atlas(), test_blocks()); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.data, err, c.want)
+		}
+	}
+}
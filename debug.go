@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/go-gl/gl/v2.1/gl"
+)
+
+const (
+	// How many of the last frames the frame time graph shows.
+	FRAME_GRAPH_SIZE = 120
+
+	// How many pixels wide each pixel of the debug screen's font is.
+	DEBUG_TEXT_SCALE = 1
+)
+
+// Names of the directions in SIDES.
+var side_names = []string{"south (+z)", "east (+x)", "north (-z)", "west (-x)"}
+
+func (self *Window) record_frame(dt float32) {
+	// Remember how long the last frame took for the frame time graph.
+
+	//
+	self.frame_times[self.frame_index] = dt
+	self.frame_index = (self.frame_index + 1) % FRAME_GRAPH_SIZE
+}
+
+func (self *Window) debug_lines() ([]string, []string) {
+	/* Returns the lines of the debug screen, those about the world for the
+	   left side and those about the process for the right.
+
+	*/
+	var total float32
+	for _, dt := range self.frame_times {
+		total += dt
+	}
+	p := self.position
+	block := normalize(p)
+	sector := sectorize(p)
+	left := []string{
+		fmt.Sprintf("%d fps (%.1f ms per frame)", int(self.fps), total/FRAME_GRAPH_SIZE*1000),
+		fmt.Sprintf("XYZ: %.3f / %.3f / %.3f", p.x, p.y, p.z),
+		fmt.Sprintf("Block: %d %d %d", int(block.x), int(block.y), int(block.z)),
+		fmt.Sprintf("Sector: %d %d, block %d %d in it", int(sector.x), int(sector.z),
+			int(block.x-sector.x*SECTOR_SIZE), int(block.z-sector.z*SECTOR_SIZE)),
+		fmt.Sprintf("Facing: %s", side_names[(self.facing()+2)%len(SIDES)]),
+	}
+	if self.flying {
+		line := fmt.Sprintf("Flying at %.1f blocks/s", self.fly_speed)
+		if self.noclipping() {
+			line += ", noclip"
+		}
+		left = append(left, line)
+	}
+
+	target, _ := self.model.hit_test(self.position, self.get_sight_vector(), 8)
+	if target.isNil() {
+		left = append(left, "Looking at: nothing")
+	} else {
+		left = append(left, fmt.Sprintf("Looking at: %s (state %d) at %d %d %d",
+			blocks.get(self.model.world[target]).name, self.model.states[target],
+			int(target.x), int(target.y), int(target.z)))
+	}
+
+	drawn := 0
+	for s := range sectors_around(self.sector, settings.render_distance) {
+		if _, ok := self.model.sectors[s]; ok {
+			drawn++
+		}
+	}
+	lists, vertices := 0, 0
+	for _, batch := range self.model.batches {
+		lists += len(batch.lists)
+		vertices += batch.vertices
+	}
+	left = append(left,
+		fmt.Sprintf("Sectors: %d loaded, %d drawn", len(self.model.sectors), drawn),
+		fmt.Sprintf("Blocks: %d shown of %d", len(self.model.shown), len(self.model.world)),
+		fmt.Sprintf("Display lists: %d, %d vertices", lists, vertices),
+		fmt.Sprintf("Entities: %d, scheduled ticks: %d", len(self.model.entities), len(self.model.scheduled_ticks)),
+	)
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	right := []string{
+		runtime.Version(),
+		fmt.Sprintf("Goroutines: %d", runtime.NumGoroutine()),
+		fmt.Sprintf("Memory: %d / %d MB", memory.HeapAlloc>>20, memory.Sys>>20),
+		fmt.Sprintf("GC: %d cycles", memory.NumGC),
+	}
+	return left, right
+}
+
+func (self *Window) draw_debug() {
+	/* Draw the debug screen: statistics down both sides of the window, and
+	   a graph of how long the last frames took along the bottom.
+
+	*/
+	left, right := self.debug_lines()
+	line := self.font.height(DEBUG_TEXT_SCALE) + 2
+	y := self.label.y - self.font.height(self.label.scale) - 10
+	for _, text := range left {
+		NewLabel(self.font, text, 10, y, DEBUG_TEXT_SCALE, Color{1, 1, 1}).draw()
+		y -= line
+	}
+	y = float32(self.height() - 10)
+	for _, text := range right {
+		x := float32(self.width()-10) - self.font.width(text, DEBUG_TEXT_SCALE)
+		NewLabel(self.font, text, x, y, DEBUG_TEXT_SCALE, Color{1, 1, 1}).draw()
+		y -= line
+	}
+
+	// One bar per frame, 2 pixels high per millisecond, oldest first. Bars
+	// of frames slower than 30 per second are red.
+	gl.Disable(gl.TEXTURE_2D)
+	gl.Begin(gl.QUADS)
+	for i := range xrange(0, FRAME_GRAPH_SIZE, 1) {
+		dt := self.frame_times[(self.frame_index+i)%FRAME_GRAPH_SIZE]
+		if dt > 1.0/30 {
+			gl.Color3f(0.9, 0.2, 0.2)
+		} else {
+			gl.Color3f(0.2, 0.9, 0.2)
+		}
+		x, h := float32(10+2*i), dt*2000
+		gl.Vertex2f(x, 10)
+		gl.Vertex2f(x+2, 10)
+		gl.Vertex2f(x+2, 10+h)
+		gl.Vertex2f(x, 10+h)
+	}
+	gl.End()
+	// A line at 60 frames per second.
+	gl.Color3f(1, 1, 1)
+	gl.Begin(gl.LINES)
+	gl.Vertex2f(10, 10+2000.0/TICKS_PER_SEC)
+	gl.Vertex2f(10+2*FRAME_GRAPH_SIZE, 10+2000.0/TICKS_PER_SEC)
+	gl.End()
+	gl.Enable(gl.TEXTURE_2D)
+}
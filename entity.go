@@ -0,0 +1,88 @@
+package main
+
+import "github.com/go-gl/gl/v2.1/gl"
+
+// Entity is anything that moves around the world on its own.
+type Entity interface {
+	// Move the entity forward by `dt` seconds. Returns false once the entity
+	// is gone and should be removed from the world.
+	update(model *Model, dt float32) bool
+	draw(model *Model)
+}
+
+func (self *Model) update_entities(dt float32) {
+	// Update every entity, dropping the ones that are gone.
+
+	//
+	entities := self.entities[:0]
+	for _, entity := range self.entities {
+		if entity.update(self, dt) {
+			entities = append(entities, entity)
+		}
+	}
+	self.entities = entities
+}
+
+func (self *Model) draw_entities() {
+	for _, entity := range self.entities {
+		entity.draw(self)
+	}
+}
+
+// FallingBlock is a block that has lost its support and falls until it
+// lands on something solid, where it becomes a block again.
+type FallingBlock struct {
+	position Vertex
+	texture  BlockID
+	dy       float32
+}
+
+func fall(model *Model, position Vertex) {
+	/* Scheduled tick of blocks that fall when there's nothing solid under
+	   them, like sand and gravel.
+
+	*/
+	below := position.add(FACES[1])
+	if texture, ok := model.world[below]; (ok && blocks.get(texture).solid) || below.y < MIN_HEIGHT {
+		return
+	}
+	texture := model.world[position]
+	model.remove_block(position)
+	model.entities = append(model.entities, &FallingBlock{position: position, texture: texture})
+}
+
+func (self *FallingBlock) update(model *Model, dt float32) bool {
+	self.dy -= dt * GRAVITY
+	self.dy = max(self.dy, -TERMINAL_VELOCITY)
+	self.position.y += self.dy * dt
+
+	// Land on the first solid block below.
+	block := normalize(self.position)
+	if texture, ok := model.world[block]; ok && blocks.get(texture).solid {
+		model.add_block(block.add(FACES[0]), self.texture)
+		return false
+	}
+	below := block.add(FACES[1])
+	if texture, ok := model.world[below]; ok && blocks.get(texture).solid && self.position.y <= block.y {
+		model.add_block(block, self.texture)
+		return false
+	}
+	if below.y < MIN_HEIGHT {
+		// Fell out of the world.
+		return false
+	}
+	return true
+}
+
+func (self *FallingBlock) draw(model *Model) {
+	l := model.light(normalize(self.position))
+	vertex_data := cube_vertices(self.position, 0.5)
+	texture_data := blocks.get(self.texture).textures
+	gl.Color3f(l, l, l)
+	gl.Begin(gl.QUADS)
+	for i, v := range vertex_data {
+		gl.TexCoord2f(texture_data[i].x, texture_data[i].y)
+		gl.Vertex3f(v.x, v.y, v.z)
+	}
+	gl.End()
+}
@@ -0,0 +1,115 @@
+package main
+
+// Fluid describes how blocks of a fluid type flow.
+type Fluid struct {
+	// How many blocks the fluid flows sideways from a source block.
+	reach int
+}
+
+// The four directions fluids flow sideways in.
+var HORIZONTAL_FACES = []Vertex{
+	NewVertex(-1, 0, 0),
+	NewVertex(1, 0, 0),
+	NewVertex(0, 0, 1),
+	NewVertex(0, 0, -1),
+}
+
+func (self *Model) fluid(position Vertex) (BlockID, bool) {
+	// Returns the type of fluid at `position`, if there is one.
+
+	//
+	texture, ok := self.world[position]
+	if !ok {
+		return texture, false
+	}
+	return texture, blocks.get(texture).fluid != nil
+}
+
+func (self *Model) fluid_height(position Vertex) float32 {
+	/* Returns how high the fluid at `position` fills its block, from 0 to
+	   1. Sources are nearly full and the fluid gets shallower the further it
+	   has flowed. Fluid with more of itself on top fills the whole block.
+
+	*/
+	texture := self.world[position]
+	if above, ok := self.world[position.add(FACES[0])]; ok && above == texture {
+		return 1
+	}
+	return float32(8-self.states[position].level()) / 9
+}
+
+func (self *Model) place_fluid(position Vertex, texture BlockID, level int) {
+	// Fill `position` with `texture` fluid which has flowed `level` blocks.
+
+	//
+	if _, ok := self.world[position]; ok {
+		self.remove_block(position)
+	}
+	self.set_state(position, BlockState(level))
+	self.add_block(position, texture)
+}
+
+func (self *Model) flow(position Vertex) {
+	/* Update the fluid at `position`. Flowing fluid dries up when it is no
+	   longer fed by a source, then the fluid falls into the space below it,
+	   or spreads out sideways if it can't.
+
+	*/
+	texture, ok := self.fluid(position)
+	if !ok {
+		return
+	}
+	fluid := blocks.get(texture).fluid
+	level := self.states[position].level()
+
+	if level > 0 {
+		// Flowing fluid is fed by the fluid above it, or by the one beside
+		// it that is nearest to a source.
+		expected := fluid.reach + 1
+		if above, ok := self.world[position.add(FACES[0])]; ok && above == texture {
+			expected = 1
+		}
+		for _, d := range HORIZONTAL_FACES {
+			key := position.add(d)
+			if other, ok := self.world[key]; ok && other == texture && self.states[key].level()+1 < expected {
+				expected = self.states[key].level() + 1
+			}
+		}
+		if expected > fluid.reach {
+			self.remove_block(position)
+			return
+		}
+		if expected != level {
+			self.place_fluid(position, texture, expected)
+			return
+		}
+	}
+
+	below := position.add(FACES[1])
+	if self.empty(below) {
+		self.place_fluid(below, texture, 1)
+		return
+	}
+	if other, ok := self.world[below]; ok && other == texture {
+		return
+	}
+	if level >= fluid.reach {
+		return
+	}
+	for _, d := range HORIZONTAL_FACES {
+		if key := position.add(d); self.empty(key) {
+			self.place_fluid(key, texture, level+1)
+		}
+	}
+}
+
+func (self *Model) empty(position Vertex) bool {
+	// Returns true if there is no block at `position` for fluid to flow into.
+
+	//
+	if position.y < MIN_HEIGHT {
+		return false
+	}
+	_, ok := self.world[position]
+	return !ok
+}
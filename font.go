@@ -0,0 +1,140 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/go-gl/gl/v2.1/gl"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	// How many glyphs are in each row of a font's texture.
+	FONT_COLUMNS = 16
+)
+
+// Font draws text in the 2d pass with a bitmap font, from a texture holding
+// all of its glyphs.
+type Font struct {
+	face    *basicfont.Face
+	texture uint32
+	// Where each character's glyph is in the texture, counting along the
+	// rows from the top left.
+	glyphs map[rune]int
+	rows   int
+}
+
+func NewFont(face *basicfont.Face) *Font {
+	/* Lay out every glyph of `face` in rows in a texture, white where the
+	   glyph is drawn and clear everywhere else.
+
+	*/
+	self := &Font{face: face, glyphs: make(map[rune]int)}
+	for _, r := range face.Ranges {
+		for c := r.Low; c < r.High; c++ {
+			self.glyphs[c] = r.Offset + int(c-r.Low)
+		}
+	}
+	w := face.Mask.Bounds().Dx()
+	n := face.Mask.Bounds().Dy() / face.Height
+	self.rows = (n + FONT_COLUMNS - 1) / FONT_COLUMNS
+
+	img := image.NewRGBA(image.Rect(0, 0, FONT_COLUMNS*w, self.rows*face.Height))
+	for i := 0; i < n; i++ {
+		x0, y0 := i%FONT_COLUMNS*w, i/FONT_COLUMNS*face.Height
+		for y := 0; y < face.Height; y++ {
+			for x := 0; x < w; x++ {
+				_, _, _, a := face.Mask.At(x, i*face.Height+y).RGBA()
+				img.Set(x0+x, y0+y, color.Alpha16{uint16(a)})
+			}
+		}
+	}
+	self.texture = load_texture(img, 0)
+	// Keep the pixels of the glyphs sharp.
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	return self
+}
+
+func (self *Font) width(text string, scale float32) float32 {
+	// Returns how wide `text` is drawn at `scale`, in pixels.
+
+	//
+	return float32(len([]rune(text))*self.face.Advance) * scale
+}
+
+func (self *Font) height(scale float32) float32 {
+	return float32(self.face.Height) * scale
+}
+
+func (self *Font) draw(text string, x, y float32, scale float32, c Color) {
+	/* Draw `text` with its top left corner at `x`, `y` in the 2d pass,
+	   `scale` times the size of the font.
+
+	   Parameters
+	   ----------
+	   text : str
+	       The text to draw, on one line.
+	   x, y : float
+	       Where to draw it, in pixels from the bottom left of the window.
+	   scale : float
+	       How many pixels wide each pixel of the font is.
+	   c : Color
+	       The color of the text.
+
+	*/
+	gl.BindTexture(gl.TEXTURE_2D, self.texture)
+	gl.Disable(gl.FOG)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+
+	w, h := float32(self.face.Mask.Bounds().Dx()), float32(self.face.Height)
+	// Size of a glyph in the texture.
+	m, n := 1/float32(FONT_COLUMNS), 1/float32(self.rows)
+	gl.Color3f(c.r, c.g, c.b)
+	gl.Begin(gl.QUADS)
+	for _, char := range text {
+		i, ok := self.glyphs[char]
+		if !ok {
+			i = self.glyphs['\ufffd']
+		}
+		// The texture is flipped, so rows count up from the bottom.
+		u, v := float32(i%FONT_COLUMNS)*m, float32(self.rows-1-i/FONT_COLUMNS)*n
+		x0, x1 := x+float32(self.face.Left)*scale, x+(float32(self.face.Left)+w)*scale
+		y0, y1 := y-h*scale, y
+		gl.TexCoord2f(u, v)
+		gl.Vertex2f(x0, y0)
+		gl.TexCoord2f(u+m, v)
+		gl.Vertex2f(x1, y0)
+		gl.TexCoord2f(u+m, v+n)
+		gl.Vertex2f(x1, y1)
+		gl.TexCoord2f(u, v+n)
+		gl.Vertex2f(x0, y1)
+		x += float32(self.face.Advance) * scale
+	}
+	gl.End()
+
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.FOG)
+}
+
+// Label is a line of text drawn at a fixed place in the 2d pass.
+type Label struct {
+	font *Font
+	text string
+	// Where the top left corner of the text is.
+	x, y  float32
+	scale float32
+	color Color
+}
+
+func NewLabel(font *Font, text string, x, y, scale float32, color Color) *Label {
+	return &Label{font: font, text: text, x: x, y: y, scale: scale, color: color}
+}
+
+func (self *Label) draw() {
+	// A dark copy of the text just behind it keeps it readable against the
+	// sky at any time of day.
+	self.font.draw(self.text, self.x+self.scale, self.y-self.scale, self.scale, Color{0, 0, 0})
+	self.font.draw(self.text, self.x, self.y, self.scale, self.color)
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/go-gl/gl/v2.1/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+const (
+	// How many stacks the hotbar holds.
+	HOTBAR_SIZE = 9
+
+	// Size of a slot of the hotbar or the inventory screen, and of the
+	// block drawn in it, in pixels.
+	SLOT_SIZE = 40
+	ICON_SIZE = 28
+
+	// How many slots wide the inventory screen is.
+	INVENTORY_COLUMNS = 9
+
+	// Size of, and space between, the icons of the health, hunger and air
+	// bars, in pixels.
+	STAT_ICON_SIZE = 14
+	STAT_ICON_GAP  = 4
+)
+
+func (self *Window) select_slot(slot int) {
+	// Select the `slot` of the hotbar, wrapping around at either end.
+
+	//
+	self.slot = ((slot % HOTBAR_SIZE) + HOTBAR_SIZE) % HOTBAR_SIZE
+}
+
+func (self *Window) on_mouse_scroll(dx, dy float64) {
+	/* Called when the mouse wheel is scrolled. Scrolling down moves the
+	   selection right along the hotbar. Scrolling while flying with
+	   control held, or as a spectator, changes how fast the player flies
+	   instead, scrolling up to go faster.
+
+	*/
+	ctrl := self.glwindow.GetKey(glfw.KeyLeftControl) == glfw.Press || self.glwindow.GetKey(glfw.KeyRightControl) == glfw.Press
+	if self.mode == SPECTATOR || (self.flying && ctrl) {
+		self.change_fly_speed(dy)
+	} else if dy < 0 {
+		self.select_slot(self.slot + 1)
+	} else if dy > 0 {
+		self.select_slot(self.slot - 1)
+	}
+}
+
+func (self *Window) toggle_inventory() {
+	/* Open or close the inventory screen. The mouse is freed to pick
+	   items while it is open, and anything left in the crafting grid is
+	   put back in the inventory when it is closed.
+
+	*/
+	self.inventory_open = !self.inventory_open
+	self.set_exclusive_mouse(!self.inventory_open)
+	if !self.inventory_open {
+		for i, stack := range self.crafting {
+			if !stack.empty() {
+				// Whatever doesn't fit stays in the grid.
+				self.crafting[i].count = self.inventory.add(stack.item, stack.count)
+				if self.crafting[i].empty() {
+					self.crafting[i] = ItemStack{}
+				}
+			}
+		}
+	}
+}
+
+func (self *Window) hotbar_slot(i int) (float32, float32) {
+	// Returns the bottom left corner of slot `i` of the hotbar.
+
+	//
+	x := float32(self.width())/2 - HOTBAR_SIZE*SLOT_SIZE/2
+	return x + float32(i*SLOT_SIZE), 10
+}
+
+func (self *Window) inventory_size() int {
+	/* Returns how many slots the inventory screen has: one for every type
+	   of item to pick from in creative mode, and the slots of the
+	   inventory past the hotbar in survival mode.
+
+	*/
+	if self.mode == SURVIVAL {
+		return INVENTORY_SIZE - HOTBAR_SIZE
+	}
+	return len(items.ids)
+}
+
+func (self *Window) inventory_slot(i int) (float32, float32) {
+	// Returns the bottom left corner of slot `i` of the inventory screen.
+
+	//
+	rows := (self.inventory_size() + INVENTORY_COLUMNS - 1) / INVENTORY_COLUMNS
+	x := float32(self.width())/2 - INVENTORY_COLUMNS*SLOT_SIZE/2
+	y := float32(self.height())/2 + float32(rows*SLOT_SIZE)/2
+	return x + float32(i%INVENTORY_COLUMNS*SLOT_SIZE), y - float32((i/INVENTORY_COLUMNS+1)*SLOT_SIZE)
+}
+
+func (self *Window) crafting_slot(i int) (float32, float32) {
+	/* Returns the bottom left corner of slot `i` of the crafting grid,
+	   which is above the inventory in survival mode, or of the slot the
+	   crafted item is taken from to its right if `i` is past the grid.
+
+	*/
+	rows := (self.inventory_size() + INVENTORY_COLUMNS - 1) / INVENTORY_COLUMNS
+	x := float32(self.width())/2 - (CRAFTING_SIZE+2)*SLOT_SIZE/2
+	y := float32(self.height())/2 + float32(rows*SLOT_SIZE)/2 + SLOT_SIZE/2
+	if i >= len(self.crafting) {
+		return x + (CRAFTING_SIZE+1)*SLOT_SIZE, y + (CRAFTING_SIZE-1)*SLOT_SIZE/2
+	}
+	return x + float32(i%CRAFTING_SIZE*SLOT_SIZE), y + float32((CRAFTING_SIZE-1-i/CRAFTING_SIZE)*SLOT_SIZE)
+}
+
+func (self *Window) slot_at(x, y float64, n int, corner func(int) (float32, float32)) (int, bool) {
+	/* Returns which of `n` slots is under the mouse at `x`, `y`, in window
+	   coordinates from the top left.
+
+	   Parameters
+	   ----------
+	   x, y : float
+	       Where the mouse is.
+	   n : int
+	       How many slots there are.
+	   corner : func
+	       Returns the bottom left corner of each slot, like hotbar_slot().
+
+	*/
+	y = float64(self.height()) - y
+	for i := range xrange(0, n, 1) {
+		sx, sy := corner(i)
+		if x >= float64(sx) && x < float64(sx+SLOT_SIZE) && y >= float64(sy) && y < float64(sy+SLOT_SIZE) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (self *Window) hotbar() []ItemStack {
+	/* Returns the stacks in the hotbar: the first row of the inventory in
+	   survival mode, or the items picked in creative mode.
+
+	*/
+	if self.mode == SURVIVAL {
+		return self.inventory.slots[:HOTBAR_SIZE]
+	}
+	return self.creative_hotbar[:]
+}
+
+func (self *Window) held() ItemStack {
+	// Returns the stack in the selected slot of the hotbar.
+
+	//
+	return self.hotbar()[self.slot]
+}
+
+func (self *Window) click_inventory(x, y float64, button glfw.MouseButton) {
+	/* Handle a click on the inventory screen. In creative mode the item
+	   clicked on is put in the selected slot of the hotbar. In survival
+	   mode the stack clicked on swaps places with the one in it, and the
+	   crafting grid is filled from it.
+
+	*/
+	if i, ok := self.slot_at(x, y, HOTBAR_SIZE, self.hotbar_slot); ok {
+		self.select_slot(i)
+		return
+	}
+	if self.mode == SURVIVAL {
+		if i, ok := self.slot_at(x, y, len(self.crafting)+1, self.crafting_slot); ok {
+			self.click_crafting(i, button)
+			return
+		}
+	}
+	i, ok := self.slot_at(x, y, self.inventory_size(), self.inventory_slot)
+	if !ok || button != glfw.MouseButtonLeft {
+		return
+	}
+	if self.mode == SURVIVAL {
+		self.inventory.swap(HOTBAR_SIZE+i, self.slot)
+	} else {
+		self.creative_hotbar[self.slot] = ItemStack{items.ids[i], 1}
+	}
+}
+
+func (self *Window) click_crafting(i int, button glfw.MouseButton) {
+	/* Handle a click on slot `i` of the crafting grid, or on the crafted
+	   item if `i` is past the grid. Left clicking a slot of the grid puts
+	   one of the selected items in it, and right clicking takes back what
+	   is in it. Clicking the crafted item crafts it.
+
+	*/
+	if i >= len(self.crafting) {
+		recipe := find_recipe(recipes, self.crafting[:])
+		if recipe == nil || !self.inventory.fits(recipe.result) {
+			return
+		}
+		result, _ := craft(recipes, self.crafting[:])
+		self.inventory.add(result.item, result.count)
+		return
+	}
+	s := &self.crafting[i]
+	if button == glfw.MouseButtonLeft {
+		held := self.held()
+		if !held.empty() && (s.empty() || (s.item == held.item && s.count < MAX_STACK)) {
+			item, _ := self.inventory.take(self.slot)
+			*s = ItemStack{item, s.count + 1}
+		}
+	} else if button == glfw.MouseButtonRight && !s.empty() {
+		s.count = self.inventory.add(s.item, s.count)
+		if s.empty() {
+			*s = ItemStack{}
+		}
+	}
+}
+
+func (self *Window) draw_hotbar() {
+	// Draw the hotbar along the bottom of the screen.
+
+	//
+	for i, stack := range self.hotbar() {
+		x, y := self.hotbar_slot(i)
+		self.draw_slot(x, y, stack, i == self.slot)
+	}
+}
+
+func (self *Window) draw_inventory() {
+	/* Draw the inventory screen over the middle of the screen: every type
+	   of item to pick from in creative mode, or the rest of the inventory
+	   and the crafting grid in survival mode.
+
+	*/
+	draw_rect(0, 0, float32(self.width()), float32(self.height()), Color{0, 0, 0}, 0.5)
+	held := self.held()
+	for i := range xrange(0, self.inventory_size(), 1) {
+		x, y := self.inventory_slot(i)
+		if self.mode == SURVIVAL {
+			self.draw_slot(x, y, self.inventory.slots[HOTBAR_SIZE+i], false)
+		} else {
+			id := items.ids[i]
+			self.draw_slot(x, y, ItemStack{id, 1}, !held.empty() && id == held.item)
+		}
+	}
+	if self.mode != SURVIVAL {
+		return
+	}
+	for i, stack := range self.crafting {
+		x, y := self.crafting_slot(i)
+		self.draw_slot(x, y, stack, false)
+	}
+	var result ItemStack
+	if recipe := find_recipe(recipes, self.crafting[:]); recipe != nil {
+		result = recipe.result
+	}
+	x, y := self.crafting_slot(len(self.crafting))
+	self.draw_slot(x, y, result, true)
+}
+
+func (self *Window) draw_slot(x, y float32, stack ItemStack, selected bool) {
+	/* Draw a slot with its bottom left corner at `x`, `y` holding `stack`,
+	   with the number of items in it in the bottom right corner if there
+	   is more than one.
+
+	*/
+	draw_rect(x+1, y+1, x+SLOT_SIZE-1, y+SLOT_SIZE-1, Color{0, 0, 0}, 0.4)
+	if selected {
+		draw_outline(x, y, x+SLOT_SIZE, y+SLOT_SIZE, Color{1, 1, 1})
+	}
+	if stack.empty() {
+		return
+	}
+	gl.BindTexture(gl.TEXTURE_2D, self.texture)
+	draw_item_icon(x+SLOT_SIZE/2, y+SLOT_SIZE/2, ICON_SIZE, stack.item)
+	if stack.count > 1 {
+		text := strconv.Itoa(stack.count)
+		tx := x + SLOT_SIZE - 3 - self.font.width(text, 1)
+		NewLabel(self.font, text, tx, y+3+self.font.height(1), 1, Color{1, 1, 1}).draw()
+	}
+}
+
+func draw_item_icon(cx, cy, size float32, item ItemID) {
+	/* Draw an item with its center at `cx`, `cy` and `size` pixels high:
+	   a block as a cube, and any other item as its tile.
+
+	*/
+	def := items.get(item)
+	if def.block != nil {
+		draw_block_icon(cx, cy, size, def.block.id)
+		return
+	}
+	r := size / 2
+	gl.Color3f(1, 1, 1)
+	gl.Begin(gl.QUADS)
+	for j, corner := range []Point2f{{cx - r, cy - r}, {cx + r, cy - r}, {cx + r, cy + r}, {cx - r, cy + r}} {
+		gl.TexCoord2f(def.icon[j].x, def.icon[j].y)
+		gl.Vertex2f(corner.x, corner.y)
+	}
+	gl.End()
+}
+
+func (self *Window) draw_stats() {
+	/* Draw the player's health over the left of the hotbar and their
+	   hunger over the right, two points to an icon, and their breath over
+	   that while they are under water.
+
+	*/
+	x0, y := self.hotbar_slot(0)
+	x1, _ := self.hotbar_slot(HOTBAR_SIZE)
+	y += SLOT_SIZE + STAT_ICON_GAP
+	draw_stat_bar(x0, y, 1, self.stats.health, MAX_HEALTH, Color{0.85, 0.1, 0.1})
+	// Hunger is drawn from the right edge in.
+	draw_stat_bar(x1-STAT_ICON_SIZE, y, -1, self.stats.hunger, MAX_HUNGER, Color{0.7, 0.45, 0.2})
+	if self.stats.air < MAX_AIR {
+		// As many bubbles as there are icons of hunger.
+		air := int(math.Ceil(float64(self.stats.air / MAX_AIR * MAX_HUNGER)))
+		draw_stat_bar(x1-STAT_ICON_SIZE, y+STAT_ICON_SIZE+STAT_ICON_GAP, -1, air, MAX_HUNGER, Color{0.3, 0.6, 1})
+	}
+}
+
+func draw_stat_bar(x, y float32, direction float32, points, most int, c Color) {
+	/* Draw a bar of icons for `points` out of `most`, two points to an
+	   icon, starting with its bottom left corner at `x`, `y` and going
+	   right if `direction` is 1 or left if it is -1. An odd point is drawn
+	   as half an icon.
+
+	*/
+	for i := range xrange(0, (most+1)/2, 1) {
+		ix := x + direction*float32(i*(STAT_ICON_SIZE+STAT_ICON_GAP))
+		draw_rect(ix, y, ix+STAT_ICON_SIZE, y+STAT_ICON_SIZE, Color{0, 0, 0}, 0.5)
+		if left := points - 2*i; left >= 2 {
+			draw_rect(ix+2, y+2, ix+STAT_ICON_SIZE-2, y+STAT_ICON_SIZE-2, c, 1)
+		} else if left == 1 {
+			draw_rect(ix+2, y+2, ix+STAT_ICON_SIZE/2, y+STAT_ICON_SIZE-2, c, 1)
+		}
+	}
+}
+
+func (self *Window) draw_death_screen() {
+	// Cover the screen in red, and tell the player how to come back.
+
+	//
+	w, h := float32(self.width()), float32(self.height())
+	draw_rect(0, 0, w, h, Color{0.6, 0, 0}, 0.5)
+	for _, line := range []struct {
+		text  string
+		y     float32
+		scale float32
+	}{{"You died!", h/2 + 60, 4}, {"Click to respawn", h/2 - 10, 2}} {
+		x := w/2 - self.font.width(line.text, line.scale)/2
+		NewLabel(self.font, line.text, x, line.y, line.scale, Color{1, 1, 1}).draw()
+	}
+}
+
+func draw_block_icon(cx, cy, size float32, texture BlockID) {
+	/* Draw a block as a cube seen from above its south east corner, with
+	   its center at `cx`, `cy` and `size` pixels high.
+
+	*/
+	def := blocks.get(texture)
+	r := size / 2
+	w := r * float32(math.Sqrt(3)/2)
+	top := Point2f{cx, cy + r}
+	left, center, right := Point2f{cx - w, cy + r/2}, Point2f{cx, cy}, Point2f{cx + w, cy + r/2}
+	bottom_left, bottom, bottom_right := Point2f{cx - w, cy - r/2}, Point2f{cx, cy - r}, Point2f{cx + w, cy - r/2}
+	// The corners of each face in the order of the corners of its texture
+	// square: bottom left, bottom right, top right, top left.
+	faces := []struct {
+		face    int
+		corners [4]Point2f
+	}{
+		{0, [4]Point2f{left, center, right, top}},
+		{4, [4]Point2f{bottom_left, bottom, center, left}},
+		{3, [4]Point2f{bottom, bottom_right, right, center}},
+	}
+	gl.Begin(gl.QUADS)
+	for _, f := range faces {
+		shade := face_shade[f.face]
+		gl.Color3f(shade, shade, shade)
+		for j, corner := range f.corners {
+			t := def.textures[f.face*4+j]
+			gl.TexCoord2f(t.x, t.y)
+			gl.Vertex2f(corner.x, corner.y)
+		}
+	}
+	gl.End()
+}
+
+func draw_rect(x0, y0, x1, y1 float32, c Color, alpha float32) {
+	// Fill the rectangle from `x0`, `y0` to `x1`, `y1` in the 2d pass.
+
+	//
+	gl.Disable(gl.TEXTURE_2D)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.Color4f(c.r, c.g, c.b, alpha)
+	gl.Begin(gl.QUADS)
+	gl.Vertex2f(x0, y0)
+	gl.Vertex2f(x1, y0)
+	gl.Vertex2f(x1, y1)
+	gl.Vertex2f(x0, y1)
+	gl.End()
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.TEXTURE_2D)
+}
+
+func draw_outline(x0, y0, x1, y1 float32, c Color) {
+	// Draw a 2 pixel wide frame just inside the rectangle from `x0`, `y0` to `x1`, `y1`.
+
+	//
+	for _, edge := range [][4]float32{{x0, y0, x1, y0 + 2}, {x0, y1 - 2, x1, y1}, {x0, y0, x0 + 2, y1}, {x1 - 2, y0, x1, y1}} {
+		draw_rect(edge[0], edge[1], edge[2], edge[3], c, 1)
+	}
+}
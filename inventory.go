@@ -0,0 +1,84 @@
+package main
+
+const (
+	// How many of one type of item fit in one slot.
+	MAX_STACK = 64
+
+	// How many slots the player's inventory has, the hotbar's first.
+	INVENTORY_SIZE = 36
+)
+
+// ItemStack is a number of items of one type held in one slot.
+type ItemStack struct {
+	item  ItemID
+	count int
+}
+
+func (self ItemStack) empty() bool {
+	return self.count <= 0
+}
+
+// Inventory is the items the player carries, in a fixed number of slots.
+type Inventory struct {
+	slots [INVENTORY_SIZE]ItemStack
+}
+
+func (self *Inventory) add(item ItemID, count int) int {
+	/* Put `count` items of type `item` in the inventory, topping up
+	   stacks of that item before starting new ones. Returns how many
+	   didn't fit.
+
+	*/
+	for i := range self.slots {
+		s := &self.slots[i]
+		if !s.empty() && s.item == item && s.count < MAX_STACK {
+			n := clamp(count, 0, MAX_STACK-s.count)
+			s.count += n
+			count -= n
+		}
+	}
+	for i := range self.slots {
+		s := &self.slots[i]
+		if count > 0 && s.empty() {
+			n := clamp(count, 0, MAX_STACK)
+			*s = ItemStack{item, n}
+			count -= n
+		}
+	}
+	return count
+}
+
+func (self *Inventory) take(slot int) (ItemID, bool) {
+	// Take one item out of `slot`. Returns false if it is empty.
+
+	//
+	s := &self.slots[slot]
+	if s.empty() {
+		return 0, false
+	}
+	s.count--
+	item := s.item
+	if s.empty() {
+		*s = ItemStack{}
+	}
+	return item, true
+}
+
+func (self *Inventory) fits(stack ItemStack) bool {
+	// Returns true if all of `stack` can be added to the inventory.
+
+	//
+	room := 0
+	for _, s := range self.slots {
+		if s.empty() {
+			room += MAX_STACK
+		} else if s.item == stack.item {
+			room += MAX_STACK - s.count
+		}
+	}
+	return room >= stack.count
+}
+
+func (self *Inventory) swap(i, j int) {
+	self.slots[i], self.slots[j] = self.slots[j], self.slots[i]
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ITEMS_PATH = "items.json"
+)
+
+// ItemID identifies a type of item. Every type of block is also an item,
+// with the same id as the block.
+type ItemID int
+
+// ItemDef describes one type of item.
+type ItemDef struct {
+	id   ItemID
+	name string
+	// The block placed with the item, or nil if it can't be placed.
+	block *BlockDef
+	// Corners of the tile in the atlas the item is drawn with, if it isn't
+	// a block.
+	icon [4]Point2f
+	// Points of hunger eating the item restores, or 0 if it can't be eaten.
+	food int
+}
+
+// ItemRegistry holds every type of item: the blocks, and the items defined
+// in the items file.
+type ItemRegistry struct {
+	defs  map[ItemID]*ItemDef
+	names map[string]*ItemDef
+	// ids of the blocks in the order they were defined, then of the other
+	// items.
+	ids []ItemID
+}
+
+// All the item types in the game.
+var items *ItemRegistry
+
+// itemDefFile is the layout of one item in the items file.
+type itemDefFile struct {
+	ID      *ItemID `json:"id"`
+	Name    string  `json:"name"`
+	Texture string  `json:"texture"`
+	Food    int     `json:"food"`
+}
+
+func load_items(resources *Resources, atlas *Atlas, registry *BlockRegistry) (*ItemRegistry, error) {
+	/* Make an item of every block in `registry`, and load the ITEMS_PATH
+	   file of `resources` with tiles from `atlas`. The items a resource
+	   pack defines replace those with the same id, and any others are
+	   added.
+
+	*/
+	self := &ItemRegistry{defs: make(map[ItemID]*ItemDef), names: make(map[string]*ItemDef)}
+	for _, id := range registry.ids {
+		def := registry.get(id)
+		item := &ItemDef{id: ItemID(id), name: def.name, block: def}
+		self.defs[item.id] = item
+		self.names[item.name] = item
+		self.ids = append(self.ids, item.id)
+	}
+
+	files, err := resources.read_all(ITEMS_PATH)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		var entries []itemDefFile
+		if err := json.Unmarshal(file.data, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.name, err)
+		}
+		// ids defined by this file, which it may not define twice.
+		defined := make(map[ItemID]bool)
+		for i, f := range entries {
+			if f.ID == nil {
+				return nil, fmt.Errorf("%s: item %d %q: missing id", file.name, i, f.Name)
+			}
+			if f.Name == "" {
+				return nil, fmt.Errorf("%s: item %d: missing name", file.name, i)
+			}
+			id := *f.ID
+			if block := registry.get(BlockID(id)); block != nil {
+				return nil, fmt.Errorf("%s: item %q: id %d is already used by block %q", file.name, f.Name, id, block.name)
+			}
+			if defined[id] {
+				return nil, fmt.Errorf("%s: item %q: id %d is already used by %q", file.name, f.Name, id, self.defs[id].name)
+			}
+			defined[id] = true
+			icon, ok := atlas.tex_coord(f.Texture)
+			if !ok {
+				return nil, fmt.Errorf("%s: item %q: no tile called %q", file.name, f.Name, f.Texture)
+			}
+			if old, ok := self.defs[id]; ok {
+				delete(self.names, old.name)
+			} else {
+				self.ids = append(self.ids, id)
+			}
+			if other, ok := self.names[f.Name]; ok {
+				return nil, fmt.Errorf("%s: item %d: name %q is already used by %d", file.name, id, f.Name, other.id)
+			}
+			if f.Food < 0 || f.Food > MAX_HUNGER {
+				return nil, fmt.Errorf("%s: item %q: food %d is not between 0 and %d", file.name, f.Name, f.Food, MAX_HUNGER)
+			}
+			def := &ItemDef{id: id, name: f.Name, icon: icon, food: f.Food}
+			self.defs[id] = def
+			self.names[def.name] = def
+		}
+	}
+	return self, nil
+}
+
+func (self *ItemRegistry) get(id ItemID) *ItemDef {
+	return self.defs[id]
+}
+
+func (self *ItemRegistry) named(name string) *ItemDef {
+	return self.names[name]
+}
@@ -0,0 +1,374 @@
+package main
+
+import "math"
+
+const (
+	// Light levels range from 0 (pitch dark) to MAX_LIGHT (open sky or
+	// the brightest light source).
+	MAX_LIGHT = 15
+
+	// Light is not tracked below the bottom layer of the world.
+	MIN_HEIGHT = -3
+)
+
+// The two independent light channels stored for every position.
+const (
+	SKY_LIGHT = iota
+	BLOCK_LIGHT
+)
+
+// Brightness of each light level, used to tint the faces of blocks.
+var light_brightness = make_light_brightness()
+
+func make_light_brightness() [MAX_LIGHT + 1]float32 {
+	var levels [MAX_LIGHT + 1]float32
+	for i := range levels {
+		levels[i] = float32(math.Pow(0.8, float64(MAX_LIGHT-i)))
+	}
+	return levels
+}
+
+// Shading of each face of a cube, in the order of FACES, so the sides of a
+// block can be told apart: the top is brightest and the bottom darkest.
+var face_shade = []float32{1.0, 0.5, 0.6, 0.6, 0.8, 0.8}
+
+// Brightness of a corner with 0, 1, 2 or 3 of the blocks around it filled in.
+var occlusion_brightness = []float32{1.0, 0.8, 0.65, 0.5}
+
+// LightChunk holds the light levels of every lit position inside one sector.
+// Positions that are missing from the maps have a light level of 0, except
+// for sky light above the highest block of a column, which is always
+// MAX_LIGHT and is never stored.
+type LightChunk struct {
+	sky   map[Vertex]uint8
+	block map[Vertex]uint8
+}
+
+func NewLightChunk() *LightChunk {
+	return &LightChunk{sky: make(map[Vertex]uint8), block: make(map[Vertex]uint8)}
+}
+
+func column(position Vertex) Vertex {
+	return NewVertex(position.x, 0, position.z)
+}
+
+func (self *Model) opaque(position Vertex) bool {
+	// Returns true if the block at `position` stops light.
+
+	//
+	if position.y < MIN_HEIGHT {
+		return true
+	}
+	texture, ok := self.world[position]
+	return ok && blocks.get(texture).opaque()
+}
+
+func (self *Model) height(position Vertex) float32 {
+	// Returns the y of the highest opaque block in the column of `position`.
+
+	//
+	if h, ok := self.heights[column(position)]; ok {
+		return h
+	}
+	return MIN_HEIGHT - 1
+}
+
+func (self *Model) get_light(channel int, position Vertex) uint8 {
+	if channel == SKY_LIGHT && position.y > self.height(position) {
+		return MAX_LIGHT
+	}
+	chunk, ok := self.lights[sectorize(position)]
+	if !ok {
+		return 0
+	}
+	if channel == SKY_LIGHT {
+		return chunk.sky[position]
+	}
+	return chunk.block[position]
+}
+
+func (self *Model) set_light(channel int, position Vertex, level uint8) {
+	s := sectorize(position)
+	chunk, ok := self.lights[s]
+	if !ok {
+		if level == 0 {
+			return
+		}
+		chunk = NewLightChunk()
+		self.lights[s] = chunk
+	}
+	levels := chunk.block
+	if channel == SKY_LIGHT {
+		levels = chunk.sky
+	}
+	if level == 0 {
+		delete(levels, position)
+	} else {
+		levels[position] = level
+	}
+}
+
+func (self *Model) light(position Vertex) float32 {
+	// Returns the brightness of the light reaching `position`, from 0 to 1.
+
+	//
+	sky := self.get_light(SKY_LIGHT, position)
+	if sky > self.sky_darkness {
+		sky -= self.sky_darkness
+	} else {
+		sky = 0
+	}
+	block := self.get_light(BLOCK_LIGHT, position)
+	if block > sky {
+		return light_brightness[block]
+	}
+	return light_brightness[sky]
+}
+
+func (self *Model) vertex_light(position Vertex, face Vertex, vertex Vertex) float32 {
+	/* Returns the brightness at the corner `vertex` of the `face` of the
+	   block at `position`. The light of the four spaces touching the corner
+	   in front of the face is averaged, and the corner is darkened by how
+	   many of those spaces are filled (ambient occlusion).
+
+	*/
+	front := position.add(face)
+
+	// Directions from the center of the face towards the corner.
+	sides := []Vertex{}
+	for _, i := range xrange(0, 3, 1) {
+		if face.get(i) != 0 {
+			continue
+		}
+		side := NewVertex(0, 0, 0)
+		if vertex.get(i) > position.get(i) {
+			side.set(i, 1)
+		} else {
+			side.set(i, -1)
+		}
+		sides = append(sides, side)
+	}
+
+	total, count := self.light(front), 1
+	occluded := 0
+	for _, side := range sides {
+		if key := front.add(side); self.opaque(key) {
+			occluded++
+		} else {
+			total += self.light(key)
+			count++
+		}
+	}
+	if occluded == 2 {
+		// Light can't reach the corner past two filled sides.
+		occluded = 3
+	} else if corner := front.add(sides[0]).add(sides[1]); self.opaque(corner) {
+		occluded++
+	} else {
+		total += self.light(corner)
+		count++
+	}
+	return total / float32(count) * occlusion_brightness[occluded]
+}
+
+func (self *Model) propagate_light(channel int, queue []Vertex, changed VertexSet) {
+	/* Flood fill light outwards from each position in `queue`, raising the
+	   level of every neighbour that is darker than its source minus one.
+
+	   Parameters
+	   ----------
+	   channel : int
+	       SKY_LIGHT or BLOCK_LIGHT.
+	   queue : list of positions
+	       The positions to spread light from.
+	   changed : set of positions
+	       Collects every position whose light level was changed.
+
+	*/
+	for len(queue) > 0 {
+		position := queue[0]
+		queue = queue[1:]
+		level := self.get_light(channel, position)
+		if level <= 1 {
+			continue
+		}
+		for _, d := range FACES {
+			key := NewVertex(position.x+d.x, position.y+d.y, position.z+d.z)
+			if self.opaque(key) || self.get_light(channel, key) >= level-1 {
+				continue
+			}
+			self.set_light(channel, key, level-1)
+			changed.add(key)
+			queue = append(queue, key)
+		}
+	}
+}
+
+type lightNode struct {
+	position Vertex
+	level    uint8
+}
+
+func (self *Model) remove_light(channel int, queue []lightNode, changed VertexSet) []Vertex {
+	/* Flood fill darkness outwards from each node in `queue`, clearing all
+	   light that came from the node's previous `level`.
+
+	   Returns the positions bordering the darkened area that still carry
+	   light, which should be passed to propagate_light() to fill it back in.
+
+	*/
+	relight := []Vertex{}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, d := range FACES {
+			key := NewVertex(node.position.x+d.x, node.position.y+d.y, node.position.z+d.z)
+			level := self.get_light(channel, key)
+			if level != 0 && level < node.level {
+				var emitted uint8
+				if texture, ok := self.world[key]; ok && channel == BLOCK_LIGHT {
+					emitted = blocks.get(texture).light
+				}
+				self.set_light(channel, key, emitted)
+				changed.add(key)
+				queue = append(queue, lightNode{key, level})
+				if emitted > 0 {
+					relight = append(relight, key)
+				}
+			} else if level >= node.level {
+				relight = append(relight, key)
+			}
+		}
+	}
+	return relight
+}
+
+func (self *Model) init_lighting() {
+	// Compute the sky and block light of the whole world from scratch.
+
+	//
+	sources := []Vertex{}
+	for position, texture := range self.world {
+		if h := self.height(position); position.y > h && self.opaque(position) {
+			self.heights[column(position)] = position.y
+		}
+		if emitted := blocks.get(texture).light; emitted > 0 {
+			self.set_light(BLOCK_LIGHT, position, emitted)
+			sources = append(sources, position)
+		}
+	}
+
+	// Sky light enters the dark part of a column from the open sky beside it.
+	sky := []Vertex{}
+	for c, h := range self.heights {
+		for _, d := range FACES {
+			if d.y != 0 {
+				continue
+			}
+			n := NewVertex(c.x+d.x, 0, c.z+d.z)
+			for y := max(self.height(n)+1, MIN_HEIGHT); y <= h; y++ {
+				sky = append(sky, NewVertex(n.x, y, n.z))
+			}
+		}
+	}
+
+	changed := NewVertexSet()
+	self.propagate_light(SKY_LIGHT, sky, changed)
+	self.propagate_light(BLOCK_LIGHT, sources, changed)
+}
+
+func (self *Model) light_block_added(position Vertex, texture BlockID, changed VertexSet) {
+	/* Update the light levels around `position` after a block has been
+	   placed there.
+
+	*/
+	emitted := blocks.get(texture).light
+	if !blocks.get(texture).opaque() {
+		// Light passes through see-through and partial blocks, which can
+		// only add light.
+		if emitted > self.get_light(BLOCK_LIGHT, position) {
+			self.set_light(BLOCK_LIGHT, position, emitted)
+			changed.add(position)
+			self.propagate_light(BLOCK_LIGHT, []Vertex{position}, changed)
+		}
+		return
+	}
+
+	// block light
+	old := self.get_light(BLOCK_LIGHT, position)
+	self.set_light(BLOCK_LIGHT, position, emitted)
+	relight := []Vertex{}
+	if old > 0 {
+		relight = self.remove_light(BLOCK_LIGHT, []lightNode{{position, old}}, changed)
+	}
+	if emitted > 0 {
+		relight = append(relight, position)
+	}
+	self.propagate_light(BLOCK_LIGHT, relight, changed)
+
+	// sky light
+	darkened := []lightNode{}
+	if h := self.height(position); position.y > h {
+		// The column below the new block is no longer open to the sky.
+		for y := max(h+1, MIN_HEIGHT); y <= position.y; y++ {
+			key := NewVertex(position.x, y, position.z)
+			darkened = append(darkened, lightNode{key, MAX_LIGHT})
+			changed.add(key)
+		}
+		self.heights[column(position)] = position.y
+	} else if old := self.get_light(SKY_LIGHT, position); old > 0 {
+		self.set_light(SKY_LIGHT, position, 0)
+		darkened = append(darkened, lightNode{position, old})
+	}
+	self.propagate_light(SKY_LIGHT, self.remove_light(SKY_LIGHT, darkened, changed), changed)
+}
+
+func (self *Model) light_block_removed(position Vertex, texture BlockID, changed VertexSet) {
+	/* Update the light levels around `position` after the block there has
+	   been removed.
+
+	*/
+	// Light flows back in from the neighbours of the now empty position.
+	neighbors := []Vertex{}
+	for _, d := range FACES {
+		neighbors = append(neighbors, NewVertex(position.x+d.x, position.y+d.y, position.z+d.z))
+	}
+
+	// block light
+	relight := neighbors
+	if emitted := blocks.get(texture).light; emitted > 0 {
+		old := self.get_light(BLOCK_LIGHT, position)
+		self.set_light(BLOCK_LIGHT, position, 0)
+		relight = append(relight, self.remove_light(BLOCK_LIGHT, []lightNode{{position, old}}, changed)...)
+	}
+	self.propagate_light(BLOCK_LIGHT, relight, changed)
+	changed.add(position)
+	if !blocks.get(texture).opaque() {
+		// Sky light already passed through it.
+		return
+	}
+
+	// sky light
+	relight = neighbors
+	if h := self.height(position); position.y == h {
+		// The column below the removed block is open to the sky again.
+		y := h - 1
+		for ; y >= MIN_HEIGHT; y-- {
+			if self.opaque(NewVertex(position.x, y, position.z)) {
+				break
+			}
+		}
+		if y < MIN_HEIGHT {
+			delete(self.heights, column(position))
+		} else {
+			self.heights[column(position)] = y
+		}
+		for y += 1; y <= h; y++ {
+			key := NewVertex(position.x, y, position.z)
+			self.set_light(SKY_LIGHT, key, 0)
+			changed.add(key)
+			relight = append(relight, key)
+		}
+	}
+	self.propagate_light(SKY_LIGHT, relight, changed)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"math"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -12,7 +13,19 @@ import (
 	"github.com/go-gl/glfw/v3.1/glfw"
 )
 
-const TICKS_PER_SEC = 60
+const (
+	TICKS_PER_SEC = 60
+
+	// Most ticks run between two frames when the game can't keep up.
+	MAX_TICKS_PER_FRAME = 10
+)
+
+var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+var world_path = flag.String("world", "world.json", "file the world is loaded from and saved to")
+var player_path = flag.String("player", "player.json", "file the player is loaded from and saved to")
+var atlas_path = flag.String("pack-atlas", "", "pack the tiles into an atlas, write it to file and exit")
+var pack_path = flag.String("pack", "", "resource pack directory or zip file to load textures and blocks from")
+var resources_path = flag.String("resources", "", "directory the game's own textures and blocks are in, by default the game's")
 
 func init() {
 	// This is needed to arrange that main() runs on main thread.
@@ -22,8 +35,6 @@ func init() {
 
 func enable_cpuprofile() {
 
-	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
-	flag.Parse()
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -62,8 +73,42 @@ func get_time() float64 {
 	return float64(time.Now().UnixNano()) / float64(time.Second)
 }
 
+func run_ticks(lag, dt float64, tick func()) float64 {
+	/* Call `tick` once for every whole tick in `lag` plus `dt` seconds,
+	   and return the time left over. The world is ticked at a fixed rate,
+	   however fast frames are drawn. If it falls too far behind it skips
+	   ahead rather than trying to catch up.
+
+	*/
+	lag = math.Min(lag+dt, float64(MAX_TICKS_PER_FRAME)/TICKS_PER_SEC)
+	for lag >= 1.0/TICKS_PER_SEC {
+		tick()
+		lag -= 1.0 / TICKS_PER_SEC
+	}
+	return lag
+}
+
 func main() {
 
+	flag.Parse()
+
+	if *atlas_path != "" {
+		// Let artists see the atlas their tiles are packed into.
+		resources, err := open_resources(*pack_path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		atlas, err := pack_atlas(resources)
+		resources.close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := atlas.save(*atlas_path); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	glwindow := initGLFW()
 	defer glfw.Terminate()
 
@@ -72,12 +117,16 @@ func main() {
 	enable_cpuprofile()
 
 	last_time := get_time()
+	lag := 0.0 // time the world is behind the clock, in seconds
 	for !glwindow.ShouldClose() {
 
 		now := get_time()
 		dt := now - last_time // in seconds
 		if dt > 1/TICKS_PER_SEC {
 			last_time = now
+
+			lag = run_ticks(lag, dt, window.tick)
+
 			window.update(float32(dt))
 			window.on_draw()
 		}
@@ -85,4 +134,10 @@ func main() {
 		glfw.PollEvents()
 	}
 
+	if err := window.model.save(*world_path); err != nil {
+		log.Printf("world %q could not be saved: %v\n", *world_path, err)
+	}
+	if err := window.save_player(*player_path); err != nil {
+		log.Printf("player %q could not be saved: %v\n", *player_path, err)
+	}
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRunTicks(t *testing.T) {
+	ticks := 0
+	tick := func() { ticks++ }
+
+	lag := run_ticks(0, 1.0/TICKS_PER_SEC, tick)
+	if ticks != 1 {
+		t.Fatalf("ran %d ticks in one tick's time, want 1", ticks)
+	}
+	if math.Abs(lag) > 1e-9 {
+		t.Fatalf("lag %v after a whole tick, want 0", lag)
+	}
+
+	// Half ticks add up.
+	ticks = 0
+	lag = run_ticks(0, 0.5/TICKS_PER_SEC, tick)
+	lag = run_ticks(lag, 0.6/TICKS_PER_SEC, tick)
+	if ticks != 1 {
+		t.Fatalf("ran %d ticks in 1.1 ticks' time, want 1", ticks)
+	}
+
+	// A long frame only runs MAX_TICKS_PER_FRAME ticks.
+	ticks = 0
+	run_ticks(0, 10, tick)
+	if ticks != MAX_TICKS_PER_FRAME {
+		t.Fatalf("ran %d ticks after a 10 second frame, want %d", ticks, MAX_TICKS_PER_FRAME)
+	}
+}
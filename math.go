@@ -57,6 +57,18 @@ func (v *Vertex) set(i int, f float32) {
 	}
 }
 
+func (v Vertex) add(o Vertex) Vertex {
+	return NewVertex(v.x+o.x, v.y+o.y, v.z+o.z)
+}
+
+func (v Vertex) sub(o Vertex) Vertex {
+	return NewVertex(v.x-o.x, v.y-o.y, v.z-o.z)
+}
+
+func (v Vertex) dot(o Vertex) float32 {
+	return v.x*o.x + v.y*o.y + v.z*o.z
+}
+
 func normalize(position Vertex) Vertex {
 	/* Accepts `position` of arbitrary precision and returns the block
 	   containing that position.
@@ -94,7 +106,7 @@ func sectorize(position Vertex) Vertex {
 
 	*/
 	normal := normalize(position)
-	x, z := normal.x/SECTOR_SIZE, normal.z/SECTOR_SIZE
+	x, z := float32(math.Floor(float64(normal.x/SECTOR_SIZE))), float32(math.Floor(float64(normal.z/SECTOR_SIZE)))
 	return NewVertex(x, 0, z)
 }
 
@@ -138,6 +150,13 @@ func (vs VertexSet) add(v Vertex) {
 	vs[v] = true
 }
 
+func abs(a float32) float32 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 func min(a, b float32) float32 {
 
 	if a < b {
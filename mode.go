@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+)
+
+// GameMode decides what the player can do.
+type GameMode int
+
+const (
+	// Flying is allowed, blocks break with a click and never run out.
+	CREATIVE GameMode = iota
+	// No flying. The player has health and hunger, has to mine blocks
+	// before placing them, and uses them up.
+	SURVIVAL
+	// The player flies through blocks and can't change anything.
+	SPECTATOR
+)
+
+// The name of each game mode, by mode.
+var mode_names = []string{"creative", "survival", "spectator"}
+
+func mode_named(name string) (GameMode, bool) {
+	// Returns the game mode called `name`.
+
+	//
+	for mode, n := range mode_names {
+		if n == name {
+			return GameMode(mode), true
+		}
+	}
+	return 0, false
+}
+
+func (self *Window) set_mode(mode GameMode) {
+	/* Switch the player to game `mode`, landing them if they can't fly
+	   in it, or taking off if they can only fly.
+
+	*/
+	self.mode = mode
+	self.stop_breaking()
+	switch mode {
+	case SURVIVAL:
+		self.flying = false
+	case SPECTATOR:
+		self.flying = true
+		if self.inventory_open {
+			self.toggle_inventory()
+		}
+	}
+}
+
+func (self *Window) noclipping() bool {
+	// Returns true if blocks don't stop the player: always in spectator
+	// mode, and while flying with noclip on in creative mode.
+
+	//
+	return self.mode == SPECTATOR || (self.mode == CREATIVE && self.flying && self.noclip)
+}
+
+func (self *Window) change_fly_speed(notches float64) {
+	// Fly FLYING_SPEED_STEP times faster for each of `notches`, or slower
+	// if it is negative.
+
+	//
+	speed := self.fly_speed * float32(math.Pow(FLYING_SPEED_STEP, notches))
+	self.fly_speed = max(MIN_FLYING_SPEED, min(MAX_FLYING_SPEED, speed))
+}
@@ -1,6 +1,11 @@
 package main
 
-import "github.com/go-gl/gl/v2.1/gl"
+import (
+	"log"
+	"os"
+
+	"github.com/go-gl/gl/v2.1/gl"
+)
 
 var FACES = []Vertex{
 	NewVertex(0, 1, 0),
@@ -11,44 +16,58 @@ var FACES = []Vertex{
 	NewVertex(0, 0, -1),
 }
 
-var grass = tex_coords(1, 0, 0, 1, 0, 0)
-var sand = tex_coords(1, 1, 1, 1, 1, 1)
-var brick = tex_coords(2, 0, 2, 0, 2, 0)
-var stone = tex_coords(2, 1, 2, 1, 2, 1)
-
-var textures = map[TextureType][]Point2f{GRASS: grass, SAND: sand, BRICK: brick, STONE: stone}
-
-type TextureType int
-
-const (
-	GRASS TextureType = iota
-	SAND
-	BRICK
-	STONE
-)
+// The sides of a block, as indexes into FACES, in the order a directional
+// block turns through: south (+z), east, north and west.
+var SIDES = []int{4, 3, 5, 2}
 
 type Model struct {
-	world   map[Vertex]TextureType
-	shown   map[Vertex]TextureType
+	world   map[Vertex]BlockID
+	shown   map[Vertex]BlockID
 	_shown  map[Vertex]CallList
 	sectors map[Vertex][]Vertex
+	lights  map[Vertex]*LightChunk
+	heights map[Vertex]float32
+
+	// The state of every block whose state isn't 0, like which way it
+	// faces or how far a fluid has flowed from its source.
+	states map[Vertex]BlockState
+
+	// When each block with a scheduled tick is due to be ticked, counted
+	// like `ticks`.
+	scheduled_ticks map[Vertex]int64
+	// How many ticks the world has been run for. Unlike the world clock,
+	// which players can set, it never goes back.
+	ticks int64
+
+	// Everything that moves in the world apart from the player.
+	entities []Entity
 
 	// texture *Texture
-	batch *Batch
+	batches []*Batch
+
+	generating bool
+
+	// World clock in ticks, and how many levels it currently dims sky light by.
+	time         float64
+	sky_darkness uint8
+
+	// Where players start, and come back to life, in the world.
+	spawn Vertex
 }
 
-func NewModel() *Model {
+func NewModel(path string) *Model {
 	self := &Model{}
 
-	// A Batch is a collection of vertex lists for batched rendering.
-	self.batch = NewBatch() /*pyglet.graphics.Batch() */
+	// A Batch is a collection of vertex lists for batched rendering. There
+	// is one for each render layer.
+	self.batches = []*Batch{NewBatch(), NewBatch(), NewBatch()} /*pyglet.graphics.Batch() */
 
 	// A mapping from position to the texture of the block at that position.
 	// This defines all the blocks that are currently in the world.
-	self.world = make(map[Vertex]TextureType)
+	self.world = make(map[Vertex]BlockID)
 
 	// Same mapping as `world` but only contains blocks that are shown.
-	self.shown = make(map[Vertex]TextureType)
+	self.shown = make(map[Vertex]BlockID)
 
 	// Mapping from position to a VertextList for all shown blocks.
 	self._shown = make(map[Vertex]CallList)
@@ -56,12 +75,43 @@ func NewModel() *Model {
 	// Mapping from sector to a list of positions inside that sector.
 	self.sectors = make(map[Vertex][]Vertex)
 
-	self.build_world()
+	// Mapping from sector to the light levels inside that sector.
+	self.lights = make(map[Vertex]*LightChunk)
+
+	// Mapping from (x, 0, z) column to the y of its highest block.
+	self.heights = make(map[Vertex]float32)
+
+	self.states = make(map[Vertex]BlockState)
+	self.scheduled_ticks = make(map[Vertex]int64)
+
+	// New worlds start at noon, and have their spawn point decided once
+	// they are built.
+	self.time = NOON
+	self.spawn = nilVertex
+
+	// Load the world saved at `path`, or build a new one if there is none.
+	// Lighting and drawing are skipped while the world is first built, and
+	// done for all blocks at once afterwards.
+	self.generating = true
+	if err := self.load(path); os.IsNotExist(err) {
+		self.build_world()
+	} else if err != nil {
+		log.Fatalf("world %q could not be loaded: %v\n", path, err)
+	}
+	self.init_lighting()
+	self.sky_darkness = sky_darkness(self.time)
+	self.generating = false
+
+	if self.spawn.isNil() {
+		// Standing on whatever is in the middle of the world.
+		origin := NewVertex(0, 0, 0)
+		self.spawn = NewVertex(0, self.height(origin)+0.5+PLAYER_EYE_HEIGHT, 0)
+	}
 
 	return self
 }
 
-func random_choice(types []TextureType) TextureType {
+func random_choice(types []BlockID) BlockID {
 	n := random_randint(0, len(types))
 	return types[n]
 }
@@ -69,18 +119,20 @@ func random_choice(types []TextureType) TextureType {
 func (self *Model) build_world() {
 	// Initialize the world by placing all the blocks.
 
+	grass, stone := blocks.id("grass"), blocks.id("stone")
+
 	n := 80 // 1/2 width and height of world
 	s := 1  // step size
 	y := 0  // initial y height
 	for _, x := range xrange(-n, n+1, s) {
 		for _, z := range xrange(-n, n+1, s) {
 			// create a layer stone an grass everywhere.
-			self.add_block(NewVertexInt(x, y-2, z), GRASS)
-			self.add_block(NewVertexInt(x, y-3, z), STONE)
+			self.add_block(NewVertexInt(x, y-2, z), grass)
+			self.add_block(NewVertexInt(x, y-3, z), stone)
 			if x == -n || x == n || z == -n || z == n {
 				// create outer walls.
 				for _, dy := range xrange(-2, 3, 1) {
-					self.add_block(NewVertexInt(x, y+dy, z), STONE)
+					self.add_block(NewVertexInt(x, y+dy, z), stone)
 				}
 			}
 		}
@@ -95,7 +147,7 @@ func (self *Model) build_world() {
 		h := random_randint(1, 6)  // height of the hill
 		s := random_randint(4, 8)  // 2 * s is the side length of the hill
 		d := 1                     // how quickly to taper off the hills
-		t := random_choice([]TextureType{GRASS, SAND, BRICK})
+		t := random_choice([]BlockID{grass, blocks.id("sand"), blocks.id("brick")})
 		for _, y := range xrange(c, c+h, 1) {
 			for _, x := range xrange(a-s, a+s+1, 1) {
 				for _, z := range xrange(b-s, b+s+1, 1) {
@@ -117,7 +169,11 @@ func (self *Model) build_world() {
 func (self *Model) hit_test(position Vertex, vector Vertex, max_distance int /*=8*/) (Vertex, Vertex) {
 	/* Line of sight search from current position. If a block is
 	   intersected it is returned, along with the block previously in the line
-	   of sight. If no block is found, return None, None.
+	   of sight, or nil if that is taken up by a block the line passed
+	   without hitting, like a slab, so nothing can be placed there. If no
+	   block is found, return None, None. The block the line starts inside,
+	   if any, is seen out of rather than hit, so a player whose head is in
+	   a block can still aim at the blocks around it.
 
 	   Parameters
 	   ----------
@@ -130,33 +186,69 @@ func (self *Model) hit_test(position Vertex, vector Vertex, max_distance int /*=
 
 	*/
 	m := 8
-	previous := nilVertex
+	previous, current := nilVertex, nilVertex
+	start := nilVertex
+	if self.inside(normalize(position), position) {
+		start = normalize(position)
+	}
 	x, y, z := position.x, position.y, position.z
 	for _ = range xrange(0, max_distance*m, 1) {
-		key := normalize(NewVertex(x, y, z))
-		if _, ok := self.world[key]; key != previous && ok {
+		point := NewVertex(x, y, z)
+		key := normalize(point)
+		if key != current && key != start {
+			previous, current = current, key
+			if !previous.isNil() && !self.replaceable(previous) {
+				previous = nilVertex
+			}
+		}
+		// Fluids can't be aimed at, only blocks behind or under them.
+		if texture, ok := self.world[key]; ok && key != start && blocks.get(texture).solid && self.inside(key, point) {
 			return key, previous
 		}
-		previous = key
 		x, y, z = x+vector.x/float32(m), y+vector.y/float32(m), z+vector.z/float32(m)
 	}
 	return nilVertex, nilVertex
 }
 
+func (self *Model) inside(position Vertex, point Vertex) bool {
+	// Returns true if `point` is inside one of the boxes of the block at `position`.
+
+	//
+	for _, box := range self.boxes(position) {
+		if box.contains(point) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Model) hidden(position Vertex, face Vertex) bool {
+	/* Returns true if the `face` of the block at `position` is covered by
+	   the block next to it. See-through blocks only cover faces of blocks of
+	   their own type, so e.g. the inside of a pool of water isn't drawn.
+
+	*/
+	other, ok := self.world[position.add(face)]
+	if !ok {
+		return false
+	}
+	return blocks.get(other).opaque() || (other == self.world[position] && blocks.get(other).shape == CUBE)
+}
+
 func (self *Model) exposed(position Vertex) bool {
 	/* Returns false is given `position` is surrounded on all 6 sides by
-	   blocks, true otherwise.
+	   blocks that hide it, true otherwise.
 
 	*/
 	for _, d := range FACES {
-		if _, ok := self.world[NewVertex(position.x+d.x, position.y+d.y, position.z+d.z)]; !ok {
+		if !self.hidden(position, d) {
 			return true
 		}
 	}
 	return false
 }
 
-func (self *Model) add_block(position Vertex, texture TextureType) {
+func (self *Model) add_block(position Vertex, texture BlockID) {
 	/* Add a block with the given `texture` and `position` to the world.
 
 	   Parameters
@@ -174,6 +266,7 @@ func (self *Model) add_block(position Vertex, texture TextureType) {
 		self.remove_block(position)
 	}
 	self.world[position] = texture
+	self.update_connections(position)
 
 	s := sectorize(position)
 	if _, ok := self.sectors[s]; !ok {
@@ -182,10 +275,56 @@ func (self *Model) add_block(position Vertex, texture TextureType) {
 		self.sectors[s] = append(self.sectors[s], position)
 	}
 
+	if self.generating {
+		return
+	}
+	// The block shades the corners of the faces around it.
+	changed := NewVertexSet()
+	changed.add(position)
+	self.light_block_added(position, texture, changed)
 	if self.exposed(position) {
 		self.show_block(position)
 	}
 	self.check_neighbors(position)
+	self.update_lit_blocks(changed)
+	self.schedule_neighbors(position)
+}
+
+func (self *Model) replaceable(position Vertex) bool {
+	// Returns true if a block can be placed at `position`: it is empty, or
+	// only holds a fluid.
+
+	//
+	_, ok := self.world[position]
+	_, fluid := self.fluid(position)
+	return !ok || fluid
+}
+
+func (self *Model) place_block(position Vertex, texture BlockID, state BlockState) bool {
+	/* Add a block like add_block(), in `state`. Only the parts of the state
+	   that the type of block has are kept: which way it faces for
+	   directional blocks and stairs, and which half it fills for slabs and
+	   stairs. Returns false, and changes nothing, if there is already a
+	   block other than a fluid at `position`.
+
+	*/
+	if !self.replaceable(position) {
+		return false
+	}
+	if _, ok := self.world[position]; ok {
+		self.remove_block(position)
+	}
+	def := blocks.get(texture)
+	var mask BlockState
+	if def.directional || def.shape == STAIRS {
+		mask |= FACING_MASK
+	}
+	if def.shape == SLAB || def.shape == STAIRS {
+		mask |= UPPER_HALF
+	}
+	self.set_state(position, state&mask)
+	self.add_block(position, texture)
+	return true
 }
 
 func (self *Model) remove_block(position Vertex) {
@@ -199,7 +338,10 @@ func (self *Model) remove_block(position Vertex) {
 	       Whether or not to immediately remove block from canvas.
 
 	*/
+	texture := self.world[position]
 	delete(self.world, position)
+	delete(self.states, position)
+	self.update_connections(position)
 	sector_id := sectorize(position)
 	sector_data := self.sectors[sector_id]
 
@@ -211,10 +353,42 @@ func (self *Model) remove_block(position Vertex) {
 		}
 	}
 
+	if self.generating {
+		return
+	}
 	if _, ok := self.shown[position]; ok {
 		self.hide_block(position)
 	}
+	changed := NewVertexSet()
+	changed.add(position)
+	self.light_block_removed(position, texture, changed)
 	self.check_neighbors(position)
+	self.update_lit_blocks(changed)
+	self.schedule_neighbors(position)
+}
+
+func (self *Model) update_lit_blocks(changed VertexSet) {
+	/* Redraw every shown block touching a position in `changed`, at a face,
+	   edge or corner, so that the new light levels and ambient occlusion
+	   are baked into its faces.
+
+	*/
+	redraw := NewVertexSet()
+	for position := range changed {
+		for _, dx := range xrange(-1, 2, 1) {
+			for _, dy := range xrange(-1, 2, 1) {
+				for _, dz := range xrange(-1, 2, 1) {
+					redraw.add(position.add(NewVertexInt(dx, dy, dz)))
+				}
+			}
+		}
+	}
+	for position := range redraw {
+		if _, ok := self.shown[position]; ok {
+			self.hide_block(position)
+			self.show_block(position)
+		}
+	}
 }
 
 func (self *Model) check_neighbors(position Vertex) {
@@ -230,9 +404,11 @@ func (self *Model) check_neighbors(position Vertex) {
 			continue
 		}
 		if self.exposed(key) {
-			if _, ok := self.shown[key]; !ok {
-				self.show_block(key)
+			if _, ok := self.shown[key]; ok {
+				// Redraw it in case one of its faces was covered or uncovered.
+				self.hide_block(key)
 			}
+			self.show_block(key)
 		} else {
 			if _, ok := self.shown[key]; ok {
 				self.hide_block(key)
@@ -258,7 +434,7 @@ func (self *Model) show_block(position Vertex) {
 	self._show_block(position, texture)
 }
 
-func (self *Model) _show_block(position Vertex, texture TextureType) {
+func (self *Model) _show_block(position Vertex, texture BlockID) {
 	/* Private implementation of the `show_block()` method.
 
 	   Parameters
@@ -270,10 +446,114 @@ func (self *Model) _show_block(position Vertex, texture TextureType) {
 	       generate.
 
 	*/
-	vertex_data := cube_vertices(position, 0.5)
-	texture_data := textures[texture]
+	def := blocks.get(texture)
+	vertex_data := make([]Vertex, 0, 24)
+	texture_data := make([]Point2f, 0, 24)
+	color_data := make([]Color, 0, 24)
+	state := self.states[position]
+	cube := cube_vertices(position, 0.5)
+	for _, box := range self.boxes(position) {
+		box_data := box_vertices(box)
+		for i, d := range FACES {
+			// Only the faces of boxes on the outside of the block can be
+			// covered by the block next to it.
+			edge := max(box.min.dot(d), box.max.dot(d)) == position.dot(d)+0.5
+			if edge && self.hidden(position, d) {
+				continue
+			}
+			face := box_data[i*4 : i*4+4]
+			tex := def.textures[i*4 : i*4+4]
+			if facing := state.facing(); def.directional && facing != 0 && d.y == 0 {
+				// Turned blocks show the texture of the side that faced this
+				// way before they were turned.
+				for k, side := range SIDES {
+					if side == i {
+						side = SIDES[(k-facing+len(SIDES))%len(SIDES)]
+						tex = def.textures[side*4 : side*4+4]
+						break
+					}
+				}
+			}
+			if def.shape != CUBE {
+				tex = crop_texture(cube[i*4:i*4+4], tex, face)
+			}
+			var colors [4]Color
+			if settings.smooth_lighting && def.shape == CUBE {
+				for j, v := range face {
+					l := self.vertex_light(position, d, v) * face_shade[i]
+					colors[j] = Color{l, l, l}
+				}
+			} else {
+				// Each face is lit by the light in the space in front of it.
+				front := position
+				if edge {
+					front = position.add(d)
+				}
+				l := self.light(front) * face_shade[i]
+				for j := range colors {
+					colors[j] = Color{l, l, l}
+				}
+			}
+			// A quad is drawn as two triangles split along the diagonal from its
+			// first corner. Start from the second corner instead when that splits
+			// it along its brighter diagonal, so a single dark corner doesn't
+			// bleed across the whole face.
+			start := 0
+			if colors[0].r+colors[2].r < colors[1].r+colors[3].r {
+				start = 1
+			}
+			for _, j := range xrange(0, 4, 1) {
+				k := (start + j) % 4
+				vertex_data = append(vertex_data, face[k])
+				texture_data = append(texture_data, tex[k])
+				color_data = append(color_data, colors[k])
+			}
+		}
+	}
+	if def.fluid != nil {
+		// Fluids only fill their block up to their surface.
+		top := position.y - 0.5 + self.fluid_height(position)
+		for i := range vertex_data {
+			if vertex_data[i].y > position.y {
+				vertex_data[i].y = top
+			}
+		}
+	}
 	// create vertex list
-	self._shown[position] = self.batch.add(gl.QUADS, vertex_data, texture_data)
+	self._shown[position] = self.batches[def.layer].add(position, gl.QUADS, vertex_data, texture_data, color_data)
+}
+
+func (self *Model) draw(eye Vertex) {
+	// Draw all shown blocks, one render layer after another.
+
+	//
+	self.batches[OPAQUE].draw()
+	self.draw_entities()
+
+	// Drop the fully see-through parts of cutout textures.
+	gl.Enable(gl.ALPHA_TEST)
+	gl.AlphaFunc(gl.GREATER, 0.5)
+	self.batches[CUTOUT].draw()
+	gl.Disable(gl.ALPHA_TEST)
+
+	// Blend translucent blocks into what's behind them. They don't write to
+	// the depth buffer, so the ones behind still get drawn.
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.DepthMask(false)
+	self.batches[TRANSLUCENT].draw_sorted(eye)
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+}
+
+func (self *Model) redraw() {
+	// Redraw every shown block, e.g. after a change to the lighting settings.
+
+	//
+	for position := range self.shown {
+		self.hide_block(position)
+		self.show_block(position)
+	}
 }
 
 func (self *Model) hide_block(position Vertex) {
@@ -321,29 +601,44 @@ func (self *Model) hide_sector(sector Vertex) {
 	}
 }
 
-func (self *Model) change_sectors(before Vertex, after Vertex) {
-	/* Move from sector `before` to sector `after`. A sector is a
-	   contiguous x, y sub-region of world. Sectors are used to speed up
-	   world rendering.
+func sectors_around(sector Vertex, pad int) VertexSet {
+	// Returns the sectors within `pad` sectors of `sector`.
 
-	*/
-	before_set := NewVertexSet()
-	after_set := NewVertexSet()
-	pad := 4
+	//
+	sectors := NewVertexSet()
+	if sector.isNil() {
+		return sectors
+	}
 	for _, dx := range xrange(-pad, pad+1, 1) {
 		dy := 0 // xrange(-pad, pad + 1){
 		for _, dz := range xrange(-pad, pad+1, 1) {
 			if PowInt(dx, 2)+PowInt(dy, 2)+PowInt(dz, 2) > PowInt((pad+1), 2) {
 				continue
 			}
-			if !before.isNil() {
-				before_set.add(NewVertex(before.x+float32(dx), before.y+float32(dy), before.z+float32(dz)))
-			}
-			if !after.isNil() {
-				after_set.add(NewVertex(after.x+float32(dx), after.y+float32(dy), after.z+float32(dz)))
-			}
+			sectors.add(NewVertex(sector.x+float32(dx), sector.y+float32(dy), sector.z+float32(dz)))
 		}
 	}
+	return sectors
+}
+
+func (self *Model) change_sectors(before Vertex, after Vertex) {
+	/* Move from sector `before` to sector `after`. A sector is a
+	   contiguous x, y sub-region of world. Sectors are used to speed up
+	   world rendering.
+
+	*/
+	pad := settings.render_distance
+	self.swap_sectors(sectors_around(before, pad), sectors_around(after, pad))
+}
+
+func (self *Model) change_render_distance(sector Vertex, before int, after int) {
+	// Show or hide sectors around `sector` when the render distance changes.
+
+	//
+	self.swap_sectors(sectors_around(sector, before), sectors_around(sector, after))
+}
+
+func (self *Model) swap_sectors(before_set VertexSet, after_set VertexSet) {
 	show := after_set.Remove(before_set)
 	hide := before_set.Remove(after_set)
 	for sector := range show {
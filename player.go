@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// PlayerFile is the layout of a saved player on disk.
+type PlayerFile struct {
+	Position [3]float32 `json:"position"`
+	Rotation [2]float32 `json:"rotation"`
+	Flying   bool       `json:"flying"`
+	Noclip   bool       `json:"noclip"`
+	FlySpeed float32    `json:"fly_speed"`
+	Mode     string     `json:"mode"`
+	// Player files from before game modes only say whether the player is
+	// in survival mode, and have no mode.
+	Survival bool    `json:"survival,omitempty"`
+	Health   int     `json:"health"`
+	Hunger   int     `json:"hunger"`
+	Air      float32 `json:"air"`
+	// The selected slot of the hotbar, and the name of the type and the
+	// number of the items in every slot of the inventory, the hotbar's
+	// first. Empty slots have no name.
+	Slot      int         `json:"slot"`
+	Inventory []StackFile `json:"inventory"`
+	// The names of the items in the creative mode hotbar.
+	Hotbar []string `json:"hotbar"`
+}
+
+type StackFile struct {
+	Item  string `json:"item,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+func (self *Window) save_player(path string) error {
+	// Write where the player is and what they carry to the file at `path`.
+
+	//
+	p := self.position
+	save := PlayerFile{
+		Position: [3]float32{p.x, p.y, p.z},
+		Rotation: [2]float32{self.rotation.x, self.rotation.y},
+		Flying:   self.flying,
+		Noclip:   self.noclip,
+		FlySpeed: self.fly_speed,
+		Mode:     mode_names[self.mode],
+		Health:   self.stats.health,
+		Hunger:   self.stats.hunger,
+		Air:      self.stats.air,
+		Slot:     self.slot,
+	}
+	// Anything left in the crafting grid is saved as if it had been put
+	// back in the inventory.
+	inventory := self.inventory
+	for _, stack := range self.crafting {
+		if !stack.empty() {
+			inventory.add(stack.item, stack.count)
+		}
+	}
+	for _, stack := range inventory.slots {
+		if stack.empty() {
+			save.Inventory = append(save.Inventory, StackFile{})
+		} else {
+			save.Inventory = append(save.Inventory, StackFile{items.get(stack.item).name, stack.count})
+		}
+	}
+	for _, stack := range self.creative_hotbar {
+		name := ""
+		if !stack.empty() {
+			name = items.get(stack.item).name
+		}
+		save.Hotbar = append(save.Hotbar, name)
+	}
+	return save_json(path, save)
+}
+
+func (self *Window) load_player(path string) error {
+	/* Put the player back where they were and give them back what they
+	   carried, from the file at `path`. Nothing changes if it can't be
+	   loaded.
+
+	*/
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Fields missing from the file keep these defaults.
+	save := PlayerFile{FlySpeed: FLYING_SPEED, Health: MAX_HEALTH, Hunger: MAX_HUNGER, Air: MAX_AIR}
+	if err := json.Unmarshal(data, &save); err != nil {
+		return err
+	}
+	if save.Mode == "" {
+		save.Mode = mode_names[CREATIVE]
+		if save.Survival {
+			save.Mode = mode_names[SURVIVAL]
+		}
+	}
+	mode, ok := mode_named(save.Mode)
+	if !ok {
+		return fmt.Errorf("unknown game mode %q", save.Mode)
+	}
+	var inventory Inventory
+	for i, s := range save.Inventory {
+		if i >= INVENTORY_SIZE || s.Item == "" || s.Count <= 0 {
+			continue
+		}
+		def := items.named(s.Item)
+		if def == nil {
+			return fmt.Errorf("item %q is not defined", s.Item)
+		}
+		inventory.slots[i] = ItemStack{def.id, clamp(s.Count, 1, MAX_STACK)}
+	}
+	hotbar := self.creative_hotbar
+	for i, name := range save.Hotbar {
+		if i >= HOTBAR_SIZE {
+			break
+		}
+		hotbar[i] = ItemStack{}
+		if name == "" {
+			continue
+		}
+		def := items.named(name)
+		if def == nil {
+			return fmt.Errorf("item %q is not defined", name)
+		}
+		hotbar[i] = ItemStack{def.id, 1}
+	}
+	self.inventory = inventory
+	self.creative_hotbar = hotbar
+	self.position = NewVertex(save.Position[0], save.Position[1], save.Position[2])
+	self.rotation = Point2f{save.Rotation[0], save.Rotation[1]}
+	self.flying = save.Flying
+	self.noclip = save.Noclip
+	self.fly_speed = max(MIN_FLYING_SPEED, min(MAX_FLYING_SPEED, save.FlySpeed))
+	self.set_mode(mode)
+	self.stats = Stats{
+		health: clamp(save.Health, 0, MAX_HEALTH),
+		hunger: clamp(save.Hunger, 0, MAX_HUNGER),
+		air:    max(0, min(MAX_AIR, save.Air)),
+	}
+	self.select_slot(save.Slot)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func resources_dir() string {
+	/* Returns the directory the game's own textures and block definitions
+	   are in: the one given with -resources, or else the one the game is
+	   in. When the game isn't next to its resources, as under `go run`,
+	   the working directory is tried last.
+
+	*/
+	if *resources_path != "" {
+		return *resources_path
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err := filepath.EvalSymlinks(exe); err == nil {
+			dir := filepath.Dir(exe)
+			if _, err := os.Stat(filepath.Join(dir, BLOCKS_PATH)); err == nil {
+				return dir
+			}
+		}
+	}
+	return "."
+}
+
+// Resources are the files textures and block definitions are loaded from:
+// the game's own, with those of a resource pack laid over them.
+type Resources struct {
+	// Where files are looked for, from the bottom layer up, and what each
+	// layer is called in errors.
+	layers []fs.FS
+	names  []string
+	closer io.Closer
+}
+
+// resourceFile is one layer's copy of a file.
+type resourceFile struct {
+	name string
+	data []byte
+}
+
+func open_resources(pack string) (*Resources, error) {
+	/* Open the game's resources, overridden by the resource pack at `pack`
+	   if it isn't empty. A resource pack is a directory or a zip file laid
+	   out like the game's own resources, holding only the files it changes.
+
+	*/
+	dir := resources_dir()
+	self := &Resources{layers: []fs.FS{os.DirFS(dir)}, names: []string{dir}}
+	if pack == "" {
+		return self, nil
+	}
+	info, err := os.Stat(pack)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		self.layers = append(self.layers, os.DirFS(pack))
+	} else {
+		z, err := zip.OpenReader(pack)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pack, err)
+		}
+		self.layers = append(self.layers, z)
+		self.closer = z
+	}
+	self.names = append(self.names, pack)
+	return self, nil
+}
+
+func (self *Resources) close() {
+	if self.closer != nil {
+		self.closer.Close()
+	}
+}
+
+func (self *Resources) read_all(name string) ([]resourceFile, error) {
+	// Returns every layer's copy of the file `name`, from the bottom layer up.
+
+	//
+	files := []resourceFile{}
+	for i, layer := range self.layers {
+		data, err := fs.ReadFile(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, resourceFile{path.Join(self.names[i], name), data})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s not found in %s", name, strings.Join(self.names, " or "))
+	}
+	return files, nil
+}
+
+func (self *Resources) read(name string) (resourceFile, error) {
+	// Returns the top layer's copy of the file `name`.
+
+	//
+	for i := len(self.layers) - 1; i >= 0; i-- {
+		data, err := fs.ReadFile(self.layers[i], name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return resourceFile{}, err
+		}
+		return resourceFile{path.Join(self.names[i], name), data}, nil
+	}
+	return resourceFile{}, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+func (self *Resources) glob(pattern string) (map[string]resourceFile, error) {
+	/* Returns the files matching `pattern` by name. Where more than one
+	   layer has a file, it is the top one's.
+
+	*/
+	files := make(map[string]resourceFile)
+	for i, layer := range self.layers {
+		names, err := fs.Glob(layer, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(layer, name)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = resourceFile{path.Join(self.names[i], name), data}
+		}
+	}
+	return files, nil
+}
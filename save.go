@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SaveFile is the layout of a saved world on disk.
+type SaveFile struct {
+	Time float64 `json:"time"`
+	// How many ticks the world has been run for, which scheduled ticks
+	// are counted in.
+	TickCount int64 `json:"tick_count"`
+	// Where players start, if it has been decided.
+	Spawn *[3]float32 `json:"spawn,omitempty"`
+	// x, y, z of every block in the world, by the name of its type.
+	Blocks map[string][][3]int `json:"blocks"`
+	// x, y, z and state of every block whose state isn't 0.
+	States [][4]int `json:"states"`
+	// x, y, z and ticks to go of every scheduled tick.
+	Ticks [][4]int `json:"ticks"`
+}
+
+func (self *Model) save(path string) error {
+	// Write the world to the file at `path`, replacing any earlier save.
+
+	//
+	save := SaveFile{Time: self.time, TickCount: self.ticks, Blocks: make(map[string][][3]int)}
+	save.Spawn = &[3]float32{self.spawn.x, self.spawn.y, self.spawn.z}
+	for position, texture := range self.world {
+		name := blocks.get(texture).name
+		save.Blocks[name] = append(save.Blocks[name], [3]int{int(position.x), int(position.y), int(position.z)})
+	}
+	for position, state := range self.states {
+		save.States = append(save.States, [4]int{int(position.x), int(position.y), int(position.z), int(state)})
+	}
+	for position, tick := range self.scheduled_ticks {
+		save.Ticks = append(save.Ticks, [4]int{int(position.x), int(position.y), int(position.z), int(tick - self.ticks)})
+	}
+	// Blocks that are still falling are saved where they are, and carry on
+	// falling when the world is loaded.
+	for _, entity := range self.entities {
+		if f, ok := entity.(*FallingBlock); ok {
+			p := normalize(f.position)
+			name := blocks.get(f.texture).name
+			save.Blocks[name] = append(save.Blocks[name], [3]int{int(p.x), int(p.y), int(p.z)})
+			save.Ticks = append(save.Ticks, [4]int{int(p.x), int(p.y), int(p.z), 1})
+		}
+	}
+	return save_json(path, save)
+}
+
+func save_json(path string, v interface{}) error {
+	// Write `v` as JSON to the file at `path`, replacing any earlier save.
+
+	//
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a failed save can't destroy the old one.
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (self *Model) load(path string) error {
+	// Add all the blocks saved in the file at `path` to the world.
+
+	//
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var save SaveFile
+	if err := json.Unmarshal(data, &save); err != nil {
+		return err
+	}
+	self.time = save.Time
+	self.ticks = save.TickCount
+	if s := save.Spawn; s != nil {
+		self.spawn = NewVertex(s[0], s[1], s[2])
+	}
+	for name, positions := range save.Blocks {
+		def := blocks.named(name)
+		if def == nil {
+			return fmt.Errorf("block %q is not defined", name)
+		}
+		for _, p := range positions {
+			self.add_block(NewVertexInt(p[0], p[1], p[2]), def.id)
+		}
+	}
+	for _, s := range save.States {
+		self.set_state(NewVertexInt(s[0], s[1], s[2]), BlockState(s[3]))
+	}
+	for _, t := range save.Ticks {
+		self.schedule_tick(NewVertexInt(t[0], t[1], t[2]), t[3])
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+// Settings holds the options the player can change while playing.
+type Settings struct {
+	// Whether faces are lit per vertex, blending the light of neighbouring
+	// spaces and darkening corners (ambient occlusion), instead of with one
+	// light level per face.
+	smooth_lighting bool
+
+	// How many sectors around the player are drawn.
+	render_distance int
+
+	// How block textures are filtered, one of the FILTER_ constants.
+	texture_filter int
+}
+
+// Ways textures can be filtered, from the blockiest to the smoothest.
+const (
+	FILTER_NEAREST = iota
+	FILTER_LINEAR
+	// Linear, and sharper where a texture is seen at a low angle.
+	FILTER_ANISOTROPIC
+)
+
+var filter_names = []string{"nearest", "linear", "anisotropic"}
+
+const (
+	MIN_RENDER_DISTANCE = 2
+	MAX_RENDER_DISTANCE = 16
+)
+
+var settings = Settings{
+	smooth_lighting: true,
+	render_distance: 4,
+	texture_filter:  FILTER_LINEAR,
+}
+
+func (self Settings) view_distance() float32 {
+	// Returns how far the player can see, in blocks.
+
+	//
+	return float32(self.render_distance * SECTOR_SIZE)
+}
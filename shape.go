@@ -0,0 +1,204 @@
+package main
+
+// Shapes of blocks. Anything but a full cube is drawn and collided with as
+// the boxes returned by shape_boxes().
+const (
+	CUBE = iota
+	// The lower or upper half of a cube.
+	SLAB
+	// A slab with a step on the half away from the way it faces.
+	STAIRS
+	// A post that connects to the blocks beside it with rails.
+	FENCE
+)
+
+var shape_names = map[string]int{"cube": CUBE, "slab": SLAB, "stairs": STAIRS, "fence": FENCE}
+
+// BlockState is the extra state of a block besides its type, packed into a
+// byte:
+//
+//	bits 0-1  which of SIDES the block faces (directional blocks, stairs)
+//	bit  2    whether the block fills the upper half (slabs, stairs)
+//	bits 4-7  which of SIDES the block connects to (fences)
+//
+// Fluids don't face anywhere and use bits 0-3 for their level instead.
+type BlockState uint8
+
+const (
+	FACING_MASK BlockState = 0x3
+	UPPER_HALF  BlockState = 0x4
+	LEVEL_MASK  BlockState = 0xf
+
+	CONNECTED_SHIFT = 4
+)
+
+func (s BlockState) facing() int {
+	return int(s & FACING_MASK)
+}
+
+func (s BlockState) upper() bool {
+	return s&UPPER_HALF != 0
+}
+
+func (s BlockState) connected(side int) bool {
+	return s&(1<<(CONNECTED_SHIFT+uint(side))) != 0
+}
+
+func (s BlockState) level() int {
+	return int(s & LEVEL_MASK)
+}
+
+// Box is an axis aligned box.
+type Box struct {
+	min, max Vertex
+}
+
+func NewBox(x0, y0, z0, x1, y1, z1 float32) Box {
+	return Box{NewVertex(x0, y0, z0), NewVertex(x1, y1, z1)}
+}
+
+func (self Box) translate(v Vertex) Box {
+	return Box{self.min.add(v), self.max.add(v)}
+}
+
+func (self Box) intersects(o Box) bool {
+	// Returns true if the boxes overlap. Boxes that only touch don't.
+
+	//
+	for _, i := range xrange(0, 3, 1) {
+		if self.max.get(i) <= o.min.get(i) || o.max.get(i) <= self.min.get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func (self Box) contains(p Vertex) bool {
+	for _, i := range xrange(0, 3, 1) {
+		if p.get(i) < self.min.get(i) || p.get(i) > self.max.get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+var full_cube = NewBox(-0.5, -0.5, -0.5, 0.5, 0.5, 0.5)
+
+func shape_boxes(shape int, state BlockState) []Box {
+	/* Returns the boxes making up a block of `shape` in `state`, relative to
+	   the center of the block.
+
+	*/
+	// The half of the block a slab fills.
+	half := NewBox(-0.5, -0.5, -0.5, 0.5, 0, 0.5)
+	if state.upper() {
+		half = NewBox(-0.5, 0, -0.5, 0.5, 0.5, 0.5)
+	}
+	switch shape {
+	case SLAB:
+		return []Box{half}
+	case STAIRS:
+		// The step is the quarter of the block on the other side from the
+		// slab, and at the back.
+		step := NewBox(-0.5, 0, -0.5, 0.5, 0.5, 0.5)
+		if state.upper() {
+			step = NewBox(-0.5, -0.5, -0.5, 0.5, 0, 0.5)
+		}
+		face := FACES[SIDES[state.facing()]]
+		for _, i := range []int{0, 2} {
+			if face.get(i) > 0 {
+				step.max.set(i, 0)
+			} else if face.get(i) < 0 {
+				step.min.set(i, 0)
+			}
+		}
+		return []Box{half, step}
+	case FENCE:
+		boxes := []Box{NewBox(-0.125, -0.5, -0.125, 0.125, 0.5, 0.125)}
+		for k, side := range SIDES {
+			if !state.connected(k) {
+				continue
+			}
+			// Two rails from the post to the edge of the block.
+			face := FACES[side]
+			for _, y := range []float32{-0.3125, 0.0625} {
+				rail := NewBox(-0.0625, y, -0.0625, 0.0625, y+0.1875, 0.0625)
+				for _, i := range []int{0, 2} {
+					if face.get(i) > 0 {
+						rail.min.set(i, 0.125)
+						rail.max.set(i, 0.5)
+					} else if face.get(i) < 0 {
+						rail.min.set(i, -0.5)
+						rail.max.set(i, -0.125)
+					}
+				}
+				boxes = append(boxes, rail)
+			}
+		}
+		return boxes
+	}
+	return []Box{full_cube}
+}
+
+func (self *Model) boxes(position Vertex) []Box {
+	// Returns the boxes the block at `position` is made of.
+
+	//
+	texture, ok := self.world[position]
+	if !ok {
+		return nil
+	}
+	boxes := shape_boxes(blocks.get(texture).shape, self.states[position])
+	for i := range boxes {
+		boxes[i] = boxes[i].translate(position)
+	}
+	return boxes
+}
+
+func (self *Model) connects(position Vertex) bool {
+	// Returns true if a fence next to `position` joins on to it.
+
+	//
+	texture, ok := self.world[position]
+	if !ok {
+		return false
+	}
+	def := blocks.get(texture)
+	return def.shape == FENCE || (def.solid && def.shape == CUBE)
+}
+
+func (self *Model) update_connections(position Vertex) {
+	/* Connect any fences at or beside `position` to the blocks around them,
+	   after the block at `position` has been added or removed.
+
+	*/
+	for _, key := range append([]Vertex{position}, horizontal_neighbors(position)...) {
+		texture, ok := self.world[key]
+		if !ok || blocks.get(texture).shape != FENCE {
+			continue
+		}
+		var state BlockState
+		for k, side := range SIDES {
+			if self.connects(key.add(FACES[side])) {
+				state |= 1 << (CONNECTED_SHIFT + uint(k))
+			}
+		}
+		self.set_state(key, state)
+	}
+}
+
+func horizontal_neighbors(position Vertex) []Vertex {
+	neighbors := make([]Vertex, 0, len(SIDES))
+	for _, side := range SIDES {
+		neighbors = append(neighbors, position.add(FACES[side]))
+	}
+	return neighbors
+}
+
+func (self *Model) set_state(position Vertex, state BlockState) {
+	if state == 0 {
+		delete(self.states, position)
+	} else {
+		self.states[position] = state
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v2.1/gl"
+)
+
+const (
+	// Length of a full day and night, in ticks.
+	DAY_LENGTH = 20 * 60 * TICKS_PER_SEC
+
+	// Times of day, in ticks from the start of a day.
+	SUNRISE  = 0
+	NOON     = DAY_LENGTH / 4
+	SUNSET   = DAY_LENGTH / 2
+	MIDNIGHT = DAY_LENGTH * 3 / 4
+
+	// How many levels sky light is dimmed by in the middle of the night.
+	MAX_SKY_DARKNESS = 11
+)
+
+var day_sky_color = Color{0.5, 0.69, 1.0}
+var night_sky_color = Color{0.01, 0.01, 0.05}
+
+func time_of_day(time float64) float64 {
+	// Returns how far through the current day `time` is, from 0 to 1.
+
+	//
+	t := math.Mod(time, DAY_LENGTH) / DAY_LENGTH
+	if t < 0 {
+		t += 1
+	}
+	return t
+}
+
+func daylight(time float64) float32 {
+	/* Returns how bright the sky is at `time`, from 0 (night) to 1 (day).
+	   The sky is brightest at noon and fades in and out around sunrise and
+	   sunset.
+
+	*/
+	d := math.Cos((time_of_day(time)-0.25)*2*math.Pi)*2 + 0.5
+	return float32(math.Max(0, math.Min(1, d)))
+}
+
+func sky_color(time float64) Color {
+	// Returns the color of the sky, and of the fog, at `time`.
+
+	//
+	d := daylight(time)
+	return Color{
+		night_sky_color.r + (day_sky_color.r-night_sky_color.r)*d,
+		night_sky_color.g + (day_sky_color.g-night_sky_color.g)*d,
+		night_sky_color.b + (day_sky_color.b-night_sky_color.b)*d,
+	}
+}
+
+func sky_darkness(time float64) uint8 {
+	// Returns how many levels sky light is dimmed by at `time`.
+
+	//
+	return uint8(round((1 - daylight(time)) * MAX_SKY_DARKNESS))
+}
+
+func (self *Model) advance_time(ticks float64) {
+	/* Move the world clock forward by `ticks`. Shown blocks are redrawn
+	   whenever the sky gets a level lighter or darker. The clock only
+	   decides how the sky looks; scheduled ticks are counted separately.
+
+	*/
+	self.time += ticks
+	if darkness := sky_darkness(self.time); darkness != self.sky_darkness {
+		self.sky_darkness = darkness
+		self.redraw()
+	}
+}
+
+func (self *Model) set_time(time float64) {
+	self.time = time
+	self.advance_time(0)
+}
+
+func (self *Window) draw_sky() {
+	/* Draw the sun and the moon on opposite sides of the sky. They are drawn
+	   around the camera rather than the origin of the world, so they stay at
+	   the same place in the sky however far the player walks.
+
+	*/
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.FOG)
+	gl.Disable(gl.TEXTURE_2D)
+	gl.Disable(gl.CULL_FACE)
+
+	gl.PushMatrix()
+	gl.Translatef(self.position.x, self.position.y, self.position.z)
+	// The sun rises in the east (+x) at SUNRISE and sets in the west.
+	gl.Rotatef(float32(time_of_day(self.model.time)*360), 0, 0, 1)
+	// Keep them just inside the far plane, scaled to look the same size at
+	// any render distance.
+	d := settings.view_distance() * 0.8
+	gl.Scalef(d, d, d)
+
+	gl.Begin(gl.QUADS)
+	// sun
+	gl.Color3f(1.0, 0.95, 0.6)
+	gl.Vertex3f(1, -0.1, -0.1)
+	gl.Vertex3f(1, 0.1, -0.1)
+	gl.Vertex3f(1, 0.1, 0.1)
+	gl.Vertex3f(1, -0.1, 0.1)
+	// moon
+	gl.Color3f(0.85, 0.85, 0.9)
+	gl.Vertex3f(-1, -0.075, -0.075)
+	gl.Vertex3f(-1, 0.075, -0.075)
+	gl.Vertex3f(-1, 0.075, 0.075)
+	gl.Vertex3f(-1, -0.075, 0.075)
+	gl.End()
+	gl.PopMatrix()
+
+	gl.Enable(gl.CULL_FACE)
+	gl.Enable(gl.TEXTURE_2D)
+	gl.Enable(gl.FOG)
+	gl.Enable(gl.DEPTH_TEST)
+}
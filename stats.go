@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	// Points of health and hunger the player has when they are full. Each
+	// heart and drumstick of the HUD is two points.
+	MAX_HEALTH = 20
+	MAX_HUNGER = 20
+
+	// How many seconds of breath the player has under water.
+	MAX_AIR = 10
+
+	// Seconds for a point of hunger to be lost, and for a point of health
+	// to be healed, while the player is fed, or lost, while they starve.
+	HUNGER_TIME = 60
+	HEAL_TIME   = 4
+	// How fed the player has to be to heal, and how low starving takes
+	// their health.
+	HEAL_HUNGER   = 18
+	STARVE_HEALTH = 1
+
+	// Falls up to this many blocks don't hurt. Each whole block further
+	// costs a point of health.
+	SAFE_FALL_HEIGHT = 3
+
+	// Points of health lost each second once the player is out of breath.
+	DROWNING_DAMAGE = 2
+)
+
+// Stats are how healthy and fed the player is.
+type Stats struct {
+	health int
+	hunger int
+	// Seconds of breath left.
+	air float32
+	// Seconds counted towards the next point of hunger lost, of health
+	// healed or starved, and until the next hurt from drowning or from
+	// the blocks the player is in.
+	hunger_time float32
+	heal_time   float32
+	hurt_time   float32
+}
+
+func NewStats() Stats {
+	return Stats{health: MAX_HEALTH, hunger: MAX_HUNGER, air: MAX_AIR}
+}
+
+func (self *Stats) update(dt float32, underwater bool, damage int) {
+	/* Move the stats on by `dt` seconds.
+
+	   Parameters
+	   ----------
+	   dt : float
+	       The change in time since the last call.
+	   underwater : bool
+	       Whether the player's head is in a fluid, so they can't breathe.
+	   damage : int
+	       Points of health a second the blocks the player is in cost them.
+
+	*/
+	self.hunger_time += dt
+	if self.hunger_time >= HUNGER_TIME {
+		self.hunger_time -= HUNGER_TIME
+		self.hunger = clamp(self.hunger-1, 0, MAX_HUNGER)
+	}
+
+	self.heal_time += dt
+	if self.heal_time >= HEAL_TIME {
+		self.heal_time -= HEAL_TIME
+		if self.hunger >= HEAL_HUNGER {
+			self.health = clamp(self.health+1, 0, MAX_HEALTH)
+		} else if self.hunger == 0 && self.health > STARVE_HEALTH {
+			self.health--
+		}
+	}
+
+	if underwater {
+		self.air = max(self.air-dt, 0)
+	} else {
+		self.air = MAX_AIR
+	}
+	if self.air <= 0 {
+		damage += DROWNING_DAMAGE
+	}
+	if damage > 0 {
+		// The first hurt comes straight away, then one a second.
+		self.hurt_time -= dt
+		if self.hurt_time <= 0 {
+			self.hurt_time += 1
+			self.damage(damage)
+		}
+	} else {
+		self.hurt_time = 0
+	}
+}
+
+func (self *Stats) damage(points int) {
+	self.health = clamp(self.health-points, 0, MAX_HEALTH)
+}
+
+func (self *Stats) eat(food int) bool {
+	// Eat something worth `food` points of hunger. Returns false if the
+	// player is too full to eat.
+
+	//
+	if self.hunger >= MAX_HUNGER {
+		return false
+	}
+	self.hunger = clamp(self.hunger+food, 0, MAX_HUNGER)
+	return true
+}
+
+func (self *Stats) dead() bool {
+	return self.health <= 0
+}
+
+func fall_damage(speed float32) int {
+	/* Returns how many points of health landing at `speed` blocks a second
+	   costs, from how far the player must have fallen to be going that
+	   fast.
+
+	*/
+	height := speed * speed / (2 * GRAVITY)
+	if height <= SAFE_FALL_HEIGHT {
+		return 0
+	}
+	return int(math.Floor(float64(height - SAFE_FALL_HEIGHT)))
+}
+
+func (self *Window) dead() bool {
+	return self.mode == SURVIVAL && self.stats.dead()
+}
+
+func (self *Window) update_stats(dt float32) {
+	/* Move the player's stats on by `dt` seconds, in survival mode. They
+	   drown with their head in a fluid, and are hurt by the blocks they
+	   are in.
+
+	*/
+	if self.mode != SURVIVAL || self.dead() {
+		return
+	}
+	_, underwater := self.model.fluid(normalize(self.position))
+	damage := 0
+	for _, position := range self.body().cells() {
+		if texture, ok := self.model.world[position]; ok {
+			if d := blocks.get(texture).damage; d > damage {
+				damage = d
+			}
+		}
+	}
+	self.stats.update(dt, underwater, damage)
+	if self.dead() {
+		self.die()
+	}
+}
+
+func (self *Window) land(speed float32) {
+	// Called when the player hits the ground going down at `speed`.
+
+	//
+	if self.mode != SURVIVAL || self.flying || self.dead() {
+		return
+	}
+	if damage := fall_damage(speed); damage > 0 {
+		self.stats.damage(damage)
+		if self.dead() {
+			self.die()
+		}
+	}
+}
+
+func (self *Window) die() {
+	// Show the death screen, and free the mouse to click on it.
+
+	//
+	if self.inventory_open {
+		self.toggle_inventory()
+	}
+	self.set_exclusive_mouse(false)
+}
+
+func (self *Window) respawn() {
+	// Bring the player back to life at the world's spawn point.
+
+	//
+	self.position = self.model.spawn
+	self.dy = 0
+	self.on_ground = false
+	self.stats = NewStats()
+	self.set_exclusive_mouse(true)
+}
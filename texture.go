@@ -3,86 +3,133 @@ package main
 import (
 	"image"
 	"image/draw"
-	"log"
-	"os"
+	"strings"
 
 	"github.com/go-gl/gl/v2.1/gl"
 )
 
-const (
-	TEXTURE_PATH = "texture.png"
-)
-
-func tex_coord(x, y float32) [4]Point2f {
-	// Return the bounding vertices of the texture square.
+func crop_texture(square []Vertex, tex []Point2f, face []Vertex) []Point2f {
+	/* Return the part of the texture square `tex` covering `face`, a part
+	   of the face of the unit cube `square` which `tex` covers.
 
-	var n float32 = 4 // original 4,  1/4 is the size of a texture in the image
-	m := 1.0 / n
-	dx := x * m
-	dy := y * m
-	return [4]Point2f{{dx, dy}, {dx + m, dy}, {dx + m, dy + m}, {dx, dy + m}}
-}
-
-func tex_coords(topx, topy, bottomx, bottomy, sidex, sidey float32) []Point2f {
-	// Return a list of the texture squares for the top, bottom and side.
-
-	top := tex_coord(topx, topy)
-	bottom := tex_coord(bottomx, bottomy)
-	side := tex_coord(sidex, sidey)
-	result := make([]Point2f, 24, 24)
-	copy(result[0:4], top[:])
-	copy(result[4:8], bottom[:])
-	copy(result[8:12], side[:])
-	copy(result[12:16], side[:])
-	copy(result[16:20], side[:])
-	copy(result[20:24], side[:])
+	*/
+	// How far along each of the edges from the first corner each corner of
+	// `face` is.
+	u, v := square[1].sub(square[0]), square[3].sub(square[0])
+	result := make([]Point2f, len(face))
+	for i, p := range face {
+		p = p.sub(square[0])
+		s, t := p.dot(u), p.dot(v)
+		result[i] = Point2f{
+			tex[0].x + s*(tex[1].x-tex[0].x) + t*(tex[3].x-tex[0].x),
+			tex[0].y + s*(tex[1].y-tex[0].y) + t*(tex[3].y-tex[0].y),
+		}
+	}
 	return result
 }
 
-func load_texture(file string) {
-
-	imgFile, err := os.Open(file)
-	if err != nil {
-		log.Fatalf("texture %q not found on disk: %v\n", file, err)
-	}
-	img, _, err := image.Decode(imgFile)
-	if err != nil {
-		panic(err)
-	}
+func load_texture(img image.Image, levels int) uint32 {
+	/* Upload `img` as a new texture with `levels` mipmaps, each half the
+	   size of the one before, and return its id.
 
+	*/
 	rgba := image.NewRGBA(img.Bounds())
 	if rgba.Stride != rgba.Rect.Size().X*4 {
 		panic("unsupported stride")
 	}
 	draw.Draw(rgba, rgba.Bounds(), img, image.Point{0, 0}, draw.Src)
+	rgba_flipped := flip(rgba)
 
+	var texture_id uint32
+	gl.GenTextures(1, &texture_id)
+	gl.BindTexture(gl.TEXTURE_2D, texture_id)
+
+	level := rgba_flipped
+	for i := 0; i <= levels; i++ {
+		if i > 0 {
+			level = half_size(level)
+		}
+		gl.TexImage2D(
+			gl.TEXTURE_2D,
+			int32(i),
+			gl.RGBA,
+			int32(level.Rect.Size().X),
+			int32(level.Rect.Size().Y),
+			0,
+			gl.RGBA,
+			gl.UNSIGNED_BYTE,
+			gl.Ptr(level.Pix))
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAX_LEVEL, int32(levels))
+	set_texture_filter(texture_id)
+
+	return texture_id
+}
+
+func flip(img *image.RGBA) *image.RGBA {
 	// flip the image on the y axis.
+
 	b := img.Bounds()
-	rgba_flipped := image.NewRGBA(b)
+	result := image.NewRGBA(b)
 	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
 		for x := b.Max.X - 1; x >= b.Min.X; x-- {
-			c := rgba.At(x, y)
-			rgba_flipped.Set(x, b.Max.Y-y, c)
+			c := img.At(x, y)
+			result.Set(x, b.Min.Y+b.Max.Y-1-y, c)
 		}
 	}
+	return result
+}
 
-	var texture_id uint32
-	gl.GenTextures(1, &texture_id)
-	gl.BindTexture(gl.TEXTURE_2D, texture_id)
+func half_size(img *image.RGBA) *image.RGBA {
+	// Shrink `img` to half its size, averaging each 2x2 square of pixels.
 
-	// gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-	// gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-
-	gl.TexImage2D(
-		gl.TEXTURE_2D,
-		0,
-		gl.RGBA,
-		int32(rgba.Rect.Size().X),
-		int32(rgba.Rect.Size().Y),
-		0,
-		gl.RGBA,
-		gl.UNSIGNED_BYTE,
-		gl.Ptr(rgba_flipped.Pix))
+	//
+	b := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, b.Dx()/2, b.Dy()/2))
+	for y := 0; y < b.Dy()/2; y++ {
+		for x := 0; x < b.Dx()/2; x++ {
+			for c := 0; c < 4; c++ {
+				sum := 0
+				for _, d := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+					sum += int(img.Pix[img.PixOffset(b.Min.X+2*x+d[0], b.Min.Y+2*y+d[1])+c])
+				}
+				result.Pix[result.PixOffset(x, y)+c] = uint8(sum / 4)
+			}
+		}
+	}
+	return result
+}
 
+func set_texture_filter(texture_id uint32) {
+	// Filter the texture `texture_id` as settings.texture_filter says.
+
+	//
+	gl.BindTexture(gl.TEXTURE_2D, texture_id)
+	switch settings.texture_filter {
+	case FILTER_NEAREST:
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST_MIPMAP_LINEAR)
+	default:
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	}
+	if anisotropy_supported() {
+		// Anisotropic filtering keeps textures seen at a low angle, like the
+		// ground ahead, sharp.
+		var anisotropy float32 = 1
+		if settings.texture_filter == FILTER_ANISOTROPIC {
+			gl.GetFloatv(gl.MAX_TEXTURE_MAX_ANISOTROPY_EXT, &anisotropy)
+		}
+		gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAX_ANISOTROPY_EXT, anisotropy)
+	}
+}
+
+func anisotropy_supported() bool {
+	extensions := gl.GoStr(gl.GetString(gl.EXTENSIONS))
+	for _, name := range strings.Fields(extensions) {
+		if name == "GL_EXT_texture_filter_anisotropic" {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,104 @@
+package main
+
+import "math/rand"
+
+// How many blocks in each sector get a random tick every tick.
+const RANDOM_TICK_SPEED = 3
+
+// BlockHandler gives blocks behaviour over time. Either function may be nil.
+type BlockHandler struct {
+	// Called when a tick scheduled with schedule_tick() for the block is due.
+	scheduled_tick func(model *Model, position Vertex)
+	// Called when the block is picked for a random tick.
+	random_tick func(model *Model, position Vertex)
+}
+
+// Behaviours blocks can be given in the block definitions file.
+var behaviours = map[string]BlockHandler{
+	"fluid": {scheduled_tick: (*Model).flow},
+	"fall":  {scheduled_tick: fall},
+	"grass": {random_tick: grass_tick},
+}
+
+func (self *Model) schedule_tick(position Vertex, delay int) {
+	/* Give the block at `position` a scheduled tick in `delay` ticks. If
+	   the block already has a tick scheduled it is left as it is.
+
+	*/
+	if _, scheduled := self.scheduled_ticks[position]; !scheduled {
+		self.scheduled_ticks[position] = self.ticks + int64(delay)
+	}
+}
+
+func (self *Model) schedule_neighbors(position Vertex) {
+	/* Give the block at `position` and the blocks next to it a scheduled
+	   tick if they react to nearby changes, e.g. so fluids flow into a space
+	   that was just cleared.
+
+	*/
+	keys := []Vertex{position}
+	for _, d := range FACES {
+		keys = append(keys, position.add(d))
+	}
+	for _, key := range keys {
+		if texture, ok := self.world[key]; ok && blocks.get(texture).update_delay > 0 {
+			self.schedule_tick(key, blocks.get(texture).update_delay)
+		}
+	}
+}
+
+func (self *Model) tick() {
+	/* Advance the world by one tick. Called TICKS_PER_SEC times a second
+	   by the main loop.
+
+	*/
+	self.ticks++
+	self.advance_time(1)
+
+	due := []Vertex{}
+	for position, tick := range self.scheduled_ticks {
+		if tick <= self.ticks {
+			due = append(due, position)
+		}
+	}
+	for _, position := range due {
+		delete(self.scheduled_ticks, position)
+		if texture, ok := self.world[position]; ok {
+			if handler := blocks.get(texture).behaviour.scheduled_tick; handler != nil {
+				handler(self, position)
+			}
+		}
+	}
+
+	self.update_entities(1.0 / TICKS_PER_SEC)
+
+	for _, positions := range self.sectors {
+		if len(positions) == 0 {
+			continue
+		}
+		for _ = range xrange(0, RANDOM_TICK_SPEED, 1) {
+			position := positions[rand.Intn(len(positions))]
+			if handler := blocks.get(self.world[position]).behaviour.random_tick; handler != nil {
+				handler(self, position)
+			}
+		}
+	}
+}
+
+func grass_tick(model *Model, position Vertex) {
+	/* Grass dies when it is covered, and otherwise slowly spreads to lit,
+	   uncovered dirt nearby.
+
+	*/
+	if model.opaque(position.add(FACES[0])) {
+		model.add_block(position, blocks.id("dirt"))
+		return
+	}
+	target := position.add(NewVertexInt(random_randint(-1, 2), random_randint(-3, 2), random_randint(-1, 2)))
+	if texture, ok := model.world[target]; !ok || texture != blocks.id("dirt") {
+		return
+	}
+	if above := target.add(FACES[0]); !model.opaque(above) && model.light(above) >= light_brightness[9] {
+		model.add_block(target, blocks.id("grass"))
+	}
+}
@@ -1,22 +1,43 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
 	"math"
 
 	"github.com/go-gl/gl/v2.1/gl"
 	"github.com/go-gl/glfw/v3.1/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"golang.org/x/image/font/basicfont"
 )
 
 const (
 	WALKING_SPEED = 5
 	FLYING_SPEED  = 15
 
+	// The slowest and fastest the mouse wheel sets flying to, and how
+	// much faster each notch makes it.
+	MIN_FLYING_SPEED  = 2
+	MAX_FLYING_SPEED  = 100
+	FLYING_SPEED_STEP = 1.25
+
 	GRAVITY           = 20.0
 	MAX_JUMP_HEIGHT   = 1.0 // About the height of a block.
 	TERMINAL_VELOCITY = 50
 
-	PLAYER_HEIGHT = 2
+	// Fluids slow down walking, gravity and falling, and holding space
+	// swims up.
+	SWIMMING_DRAG              = 0.4
+	SWIMMING_TERMINAL_VELOCITY = 3
+	SWIMMING_SPEED             = 3
+
+	// Size of the box the player takes up, and how high their eyes are
+	// above their feet.
+	PLAYER_WIDTH      = 0.5
+	PLAYER_HEIGHT     = 1.5
+	PLAYER_EYE_HEIGHT = 1.25
 
 	// Size of sectors used to ease block loading.
 	SECTOR_SIZE = 16
@@ -28,16 +49,47 @@ type Window struct {
 	glwindow  *glfw.Window
 	exclusive bool
 	flying    bool
+	noclip    bool
+	fly_speed float32
 	strafe    Point2i
 	position  Vertex
 	rotation  Point2f
 	sector    Vertex
 	reticle   []Point2i
 	dy        float32
-	inventory []TextureType
-	block     TextureType
-	model     *Model
-	num_keys  map[glfw.Key]int
+	on_ground bool
+	inventory Inventory
+	// The items in the hotbar in creative mode, kept apart from the
+	// inventory so picking them doesn't replace what the player carries.
+	creative_hotbar [HOTBAR_SIZE]ItemStack
+	slot            int
+	mode            GameMode
+	stats           Stats
+	model           *Model
+	num_keys        map[glfw.Key]int
+	console         *Console
+	atlas           *Atlas
+	texture         uint32
+	font            *Font
+	label           *Label
+	// Frames drawn per second, and the frames counted towards the next
+	// measurement.
+	fps         float32
+	frames      int
+	frames_time float32
+	// Whether the debug screen is shown, and how long the last frames took.
+	debug       bool
+	frame_times [FRAME_GRAPH_SIZE]float32
+	frame_index int
+	// Whether the inventory screen is open, and the items put in its
+	// crafting grid.
+	inventory_open bool
+	crafting       [CRAFTING_SIZE * CRAFTING_SIZE]ItemStack
+	// Whether the left mouse button is held down to break blocks, which
+	// block is being broken and how far, from 0 to 1.
+	breaking       bool
+	break_target   Vertex
+	break_progress float32
 }
 
 func NewWindow(glwindow *glfw.Window) *Window {
@@ -52,6 +104,12 @@ func NewWindow(glwindow *glfw.Window) *Window {
 	// When flying gravity has no effect and speed is increased.
 	self.flying = false
 
+	// When flying with noclip on, blocks don't stop the player.
+	self.noclip = false
+
+	// How fast the player flies, in blocks per second.
+	self.fly_speed = FLYING_SPEED
+
 	// Strafing is moving lateral to the direction you are facing,
 	// e.g. moving to the left or right while continuing to face forward.
 
@@ -81,20 +139,54 @@ func NewWindow(glwindow *glfw.Window) *Window {
 	// Velocity in the y (upward) direction.
 	self.dy = 0
 
-	// A list of blocks the player can place. Hit num keys to cycle.
-	self.inventory = []TextureType{BRICK, GRASS, SAND}
+	// No block is being broken.
+	self.break_target = nilVertex
+
+	// The textures and types of blocks in the world.
+	if err := self.load_resources(); err != nil {
+		log.Fatalf("resources could not be loaded: %v (use -resources to say where they are)\n", err)
+	}
+
+	// What the player can do, one of the game modes like CREATIVE.
+	self.mode = CREATIVE
 
-	// The current block the user can place. Hit num keys to cycle.
-	self.block = self.inventory[0]
+	// How healthy and fed the player is, in survival mode.
+	self.stats = NewStats()
+
+	// The items in the hotbar in creative mode. Hit num keys or scroll to
+	// select one, and press E to pick others. In survival mode the hotbar
+	// is the first row of the inventory, which starts empty.
+	for i, name := range []string{"brick", "grass", "log", "planks", "furnace", "stone_slab", "planks_stairs", "fence", "glass"} {
+		if def := items.named(name); def != nil {
+			self.creative_hotbar[i] = ItemStack{def.id, 1}
+		} else {
+			self.creative_hotbar[i] = ItemStack{items.ids[i%len(items.ids)], 1}
+		}
+	}
+
+	// The current block the user can place.
+	self.select_slot(0)
 
 	// Convenience list of num keys.
-	self.num_keys = map[glfw.Key]int{glfw.Key1: 0, glfw.Key2: 1, glfw.Key3: 2, glfw.Key4: 3, glfw.Key5: 4, glfw.Key6: 5, glfw.Key7: 6, glfw.Key8: 7, glfw.Key9: 8, glfw.Key0: 9}
+	self.num_keys = map[glfw.Key]int{glfw.Key1: 0, glfw.Key2: 1, glfw.Key3: 2, glfw.Key4: 3, glfw.Key5: 4, glfw.Key6: 5, glfw.Key7: 6, glfw.Key8: 7, glfw.Key9: 8}
 
 	// Instance of the model that handles the world.
-	self.model = NewModel()
+	self.model = NewModel(*world_path)
+
+	// New players start at the world's spawn point.
+	self.position = self.model.spawn
+
+	// Where the player was and what they carried when they last played.
+	if err := self.load_player(*player_path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("player %q could not be loaded: %v\n", *player_path, err)
+	}
+
+	// Commands typed into the terminal.
+	self.console = NewConsole()
 
 	// The label that is displayed in the top left of the canvas.
-	// self.label = NewLabel("", font_name="Arial", font_size=18, x=10, y=self.height - 10, anchor_x="left", anchor_y="top", color=(0, 0, 0, 255))
+	self.font = NewFont(basicfont.Face7x13)
+	self.label = NewLabel(self.font, "", 10, float32(self.height()-10), 2, Color{1, 1, 1})
 
 	// This call schedules the `update()` method to be called
 	// TICKS_PER_SEC. This is the main game event loop.
@@ -104,10 +196,8 @@ func NewWindow(glwindow *glfw.Window) *Window {
 	// Hide the mouse cursor and prevent the mouse from leaving the window.
 	self.set_exclusive_mouse(true)
 
-	gl.ClearColor(0.5, 0.69, 1.0, 1)
 	gl.Enable(gl.CULL_FACE)
 	gl.Enable(gl.TEXTURE_2D)
-	load_texture(TEXTURE_PATH)
 
 	glwindow.SetCursorPosCallback(func(w *glfw.Window, xpos float64, ypos float64) {
 		self.on_mouse_motion(xpos, ypos)
@@ -123,8 +213,13 @@ func NewWindow(glwindow *glfw.Window) *Window {
 		if action == glfw.Press {
 			x, y := w.GetCursorPos()
 			self.on_mouse_press(x, y, button, mod)
+		} else if action == glfw.Release {
+			self.on_mouse_release(button)
 		}
 	})
+	glwindow.SetScrollCallback(func(w *glfw.Window, xoff float64, yoff float64) {
+		self.on_mouse_scroll(xoff, yoff)
+	})
 	glwindow.SetSizeCallback(func(w *glfw.Window, width int, height int) {
 		self.on_resize(width, height)
 	})
@@ -162,6 +257,10 @@ func (self *Window) set_exclusive_mouse(exclusive bool) {
 	}
 	self.glwindow.SetInputMode(glfw.CursorMode, value)
 	self.exclusive = exclusive
+	if !exclusive {
+		// The button may be let go of outside the window.
+		self.stop_breaking()
+	}
 }
 
 func (self *Window) get_sight_vector() Vertex {
@@ -180,6 +279,21 @@ func (self *Window) get_sight_vector() Vertex {
 	return NewVertex(float32(dx), float32(dy), float32(dz))
 }
 
+func (self *Window) facing() int {
+	// Returns which of SIDES points most directly back at the player.
+
+	//
+	vector := self.get_sight_vector()
+	best, facing := float32(0), 0
+	for i, side := range SIDES {
+		face := FACES[side]
+		if dot := -(vector.x*face.x + vector.z*face.z); dot > best {
+			best, facing = dot, i
+		}
+	}
+	return facing
+}
+
 func (self *Window) get_motion_vector() Vertex {
 	/* Returns the current motion vector indicating the velocity of the
 	   player.
@@ -234,16 +348,32 @@ func (self *Window) update(dt float32) {
 	       The change in time since the last call.
 
 	*/
+	self.console.update(self)
+
+	// Count the frames drawn each second.
+	self.record_frame(dt)
+	self.frames++
+	self.frames_time += dt
+	if self.frames_time >= 1 {
+		self.fps = float32(self.frames) / self.frames_time
+		self.frames, self.frames_time = 0, 0
+	}
+
 	sector := sectorize(self.position)
 	if sector != self.sector {
-		// TODO self.model.change_sectors(self.sector, sector)
+		self.model.change_sectors(self.sector, sector)
 		self.sector = sector
 	}
+	if self.dead() {
+		return
+	}
 	m := 8
 	dt = min(dt, 0.2)
 	for _ = range xrange(0, m, 1) {
 		self._update(dt / float32(m))
 	}
+	self.update_breaking(dt)
+	self.update_stats(dt)
 }
 
 func (self *Window) _update(dt float32) {
@@ -259,16 +389,29 @@ func (self *Window) _update(dt float32) {
 	// walking
 	var speed float32
 	if self.flying {
-		speed = FLYING_SPEED
+		speed = self.fly_speed
 	} else {
 		speed = WALKING_SPEED
 	}
+	swimming := !self.flying && self.swimming()
+	if swimming {
+		speed *= SWIMMING_DRAG
+	}
 	d := dt * speed // distance covered this tick.
 	dv := self.get_motion_vector()
 	// New position in space, before accounting for gravity.
 	dx, dy, dz := dv.x*d, dv.y*d, dv.z*d
 	// gravity
-	if !self.flying {
+	if swimming {
+		// Sink slowly, unless space is held to swim up.
+		if self.glwindow.GetKey(glfw.KeySpace) == glfw.Press {
+			self.dy = SWIMMING_SPEED
+		} else {
+			self.dy -= dt * GRAVITY * SWIMMING_DRAG
+			self.dy = max(self.dy, -SWIMMING_TERMINAL_VELOCITY)
+		}
+		dy += self.dy * dt
+	} else if !self.flying {
 		// Update your vertical speed: if you are falling, speed up until you
 		// hit terminal velocity; if you are jumping, slow down until you
 		// start falling.
@@ -276,63 +419,26 @@ func (self *Window) _update(dt float32) {
 		self.dy = max(self.dy, -TERMINAL_VELOCITY)
 		dy += self.dy * dt
 	}
+	motion := NewVertex(dx, dy, dz)
+	if self.noclipping() {
+		self.position = self.position.add(motion)
+		self.on_ground = false
+		return
+	}
 	// collisions
-	self.position = self.collide(NewVertex(self.position.x+dx, self.position.y+dy, self.position.z+dz), PLAYER_HEIGHT)
+	self.move(motion)
 }
 
-const PAD = 0.25
-
-func (self *Window) collide(position Vertex, height int) Vertex {
-	/* Checks to see if the player at the given `position` and `height`
-	   is colliding with any blocks in the world.
-
-	   Parameters
-	   ----------
-	   position : tuple of len 3
-	       The (x, y, z) position to check for collisions at.
-	   height : int or float
-	       The height of the player.
-
-	   Returns
-	   -------
-	   position : tuple of len 3
-	       The new position of the player taking into account collisions.
+func (self *Window) swimming() bool {
+	// Returns true if any part of the player is in a fluid.
 
-	*/
-	// How much overlap with a dimension of a surrounding block you need to
-	// have to count as a collision. If 0, touching terrain at all counts as
-	// a collision. If .49, you sink into the ground, as if walking through
-	// tall grass. If >= .5, you"ll fall through the ground.
-	p := position
-	np := normalize(position)
-	for _, face := range FACES { // check all surrounding blocks
-		for _, i := range xrange(0, 3, 1) { // check each dimension independently
-			if face.get(i) == 0 {
-				continue
-			}
-			// How uch overlap you have with this dimension.
-			d := (p.get(i) - np.get(i)) * face.get(i)
-			if d < PAD {
-				continue
-			}
-			for _, dy := range xrange(0, height, 1) { // check each height
-				op := np
-				op.set(1, op.get(1)-float32(dy))
-				op.set(i, op.get(i)+face.get(i))
-				if _, ok := self.model.world[op]; !ok {
-					continue
-				}
-				p.set(i, p.get(i)-(d-PAD)*face.get(i))
-				if face == NewVertex(0, -1, 0) || face == NewVertex(0, 1, 0) {
-					// You are colliding with the ground or ceiling, so stop
-					// falling / rising.
-					self.dy = 0
-				}
-				break
-			}
+	//
+	for _, position := range self.body().cells() {
+		if _, ok := self.model.fluid(position); ok {
+			return true
 		}
 	}
-	return p
+	return false
 }
 
 func (self *Window) on_mouse_press(x, y float64, button glfw.MouseButton, modifiers glfw.ModifierKey) {
@@ -352,18 +458,43 @@ func (self *Window) on_mouse_press(x, y float64, button glfw.MouseButton, modifi
 	mouse button was clicked.
 
 	*/
-	if self.exclusive {
+	if self.dead() {
+		self.respawn()
+	} else if self.inventory_open {
+		self.click_inventory(x, y, button)
+	} else if self.exclusive {
+		if self.mode == SPECTATOR {
+			// Spectators can only look.
+			return
+		}
 		vector := self.get_sight_vector()
 		block, previous := self.model.hit_test(self.position, vector, 8)
 		if (button == glfw.MouseButtonRight) || ((button == glfw.MouseButtonLeft) && (modifiers&glfw.ModControl) != 0) {
 			// ON OSX, control + left click = right click.
-			if !previous.isNil() {
-				self.model.add_block(previous, self.block)
+			held := self.held()
+			if self.mode == SURVIVAL && !held.empty() && items.get(held.item).food > 0 {
+				if self.stats.eat(items.get(held.item).food) {
+					self.inventory.take(self.slot)
+				}
+			} else if !previous.isNil() && !held.empty() && items.get(held.item).block != nil {
+				state := BlockState(self.facing())
+				if block.y > previous.y {
+					// Slabs and stairs placed under a block hang from it.
+					state |= UPPER_HALF
+				}
+				texture := items.get(held.item).block.id
+				if self.model.place_block(previous, texture, state) && self.mode == SURVIVAL {
+					self.inventory.take(self.slot)
+				}
 			}
-		} else if button == glfw.MouseButtonLeft && !block.isNil() {
-			texture := self.model.world[block]
-			if texture != STONE {
-				self.model.remove_block(block)
+		} else if button == glfw.MouseButtonLeft {
+			if self.mode == CREATIVE {
+				// Blocks break straight away in creative mode.
+				if !block.isNil() {
+					self.break_block(block)
+				}
+			} else {
+				self.start_breaking()
 			}
 		}
 	} else {
@@ -371,6 +502,15 @@ func (self *Window) on_mouse_press(x, y float64, button glfw.MouseButton, modifi
 	}
 }
 
+func (self *Window) on_mouse_release(button glfw.MouseButton) {
+	// Called when a mouse button is released.
+
+	//
+	if button == glfw.MouseButtonLeft {
+		self.stop_breaking()
+	}
+}
+
 var last_mouse_x, last_mouse_y float64 = 0, 0
 
 func (self *Window) on_mouse_motion(x, y float64) {
@@ -420,17 +560,125 @@ func (self *Window) on_key_press(symbol glfw.Key, modifiers glfw.ModifierKey) {
 	} else if symbol == glfw.KeyA {
 		self.strafe.y += 1
 	} else if symbol == glfw.KeySpace {
-		if self.dy == 0 {
+		if self.on_ground {
 			self.dy = JUMP_SPEED
 		}
 	} else if symbol == glfw.KeyEscape {
-		self.set_exclusive_mouse(false)
-	} else if symbol == glfw.KeyTab {
+		if self.inventory_open {
+			self.toggle_inventory()
+		} else {
+			self.set_exclusive_mouse(false)
+		}
+	} else if symbol == glfw.KeyE && !self.dead() && self.mode != SPECTATOR {
+		self.toggle_inventory()
+	} else if symbol == glfw.KeyTab && self.mode == CREATIVE {
+		// Only creative mode has a choice.
 		self.flying = !self.flying
-	} else if _, ok := self.num_keys[symbol]; ok {
-		index := self.num_keys[symbol] % len(self.inventory)
-		self.block = self.inventory[index]
+	} else if symbol == glfw.KeyN && self.mode == CREATIVE {
+		// Noclip takes off, so the player doesn't land inside a block.
+		self.noclip = !self.noclip
+		self.flying = self.flying || self.noclip
+	} else if symbol == glfw.KeyO {
+		settings.smooth_lighting = !settings.smooth_lighting
+		self.model.redraw()
+	} else if symbol == glfw.KeyF {
+		// F draws further, shift + F nearer.
+		if modifiers&glfw.ModShift != 0 {
+			self.set_render_distance(settings.render_distance - 1)
+		} else {
+			self.set_render_distance(settings.render_distance + 1)
+		}
+	} else if symbol == glfw.KeyF3 {
+		self.debug = !self.debug
+	} else if symbol == glfw.KeyF5 {
+		if err := self.load_resources(); err != nil {
+			log.Printf("resources could not be reloaded: %v\n", err)
+		}
+	} else if index, ok := self.num_keys[symbol]; ok {
+		self.select_slot(index)
+	}
+}
+
+func (self *Window) tick() {
+	// Move the world, and the animated textures, on by a tick.
+
+	//
+	self.model.tick()
+	self.atlas.animate(self.texture)
+}
+
+func (self *Window) load_resources() error {
+	/* Load the textures, block and item definitions and recipes, from the
+	   resource pack if there is one, replacing any loaded before. Nothing
+	   changes if any of them can't be loaded.
+
+	*/
+	resources, err := open_resources(*pack_path)
+	if err != nil {
+		return err
+	}
+	defer resources.close()
+	atlas, err := pack_atlas(resources)
+	if err != nil {
+		return err
 	}
+	registry, err := load_blocks(resources, atlas)
+	if err != nil {
+		return err
+	}
+	if blocks != nil {
+		// The world may have any of the blocks it had before in it.
+		for _, id := range blocks.ids {
+			if registry.get(id) == nil {
+				return fmt.Errorf("block %q (id %d) is no longer defined", blocks.get(id).name, id)
+			}
+		}
+	}
+	item_registry, err := load_items(resources, atlas, registry)
+	if err != nil {
+		return err
+	}
+	if items != nil {
+		// And the player may be carrying any of the items.
+		for _, id := range items.ids {
+			if item_registry.get(id) == nil {
+				return fmt.Errorf("item %q (id %d) is no longer defined", items.get(id).name, id)
+			}
+		}
+	}
+	book, err := load_recipes(resources, item_registry)
+	if err != nil {
+		return err
+	}
+
+	blocks = registry
+	items = item_registry
+	recipes = book
+	self.atlas = atlas
+	if self.texture != 0 {
+		gl.DeleteTextures(1, &self.texture)
+	}
+	self.texture = load_texture(atlas.image, atlas.mipmap_levels())
+	if self.model != nil {
+		// Light isn't worked out again, so blocks only light the world
+		// differently once they are placed again.
+		self.model.redraw()
+	}
+	return nil
+}
+
+func (self *Window) set_render_distance(distance int) {
+	// Change how many sectors around the player are drawn.
+
+	//
+	if distance < MIN_RENDER_DISTANCE {
+		distance = MIN_RENDER_DISTANCE
+	} else if distance > MAX_RENDER_DISTANCE {
+		distance = MAX_RENDER_DISTANCE
+	}
+	self.model.change_render_distance(self.sector, settings.render_distance, distance)
+	settings.render_distance = distance
+	setup_fog()
 }
 
 func (self *Window) on_key_release(symbol glfw.Key, modifiers glfw.ModifierKey) {
@@ -460,7 +708,7 @@ func (self *Window) on_resize(width, height int) {
 	// Called when the window is resized to a new `width` and `height`.
 
 	// label
-	// self.label.y = height - 10
+	self.label.y = float32(height - 10)
 	// reticle
 	/*if self.reticle != nil {
 		self.reticle.delete()
@@ -492,7 +740,7 @@ func (self *Window) set_3d() {
 	gl.MatrixMode(gl.PROJECTION)
 	gl.LoadIdentity()
 
-	gluPerspective(45.0, float32(self.width())/float32(self.height()), 0.1, 60.0)
+	gluPerspective(45.0, float32(self.width())/float32(self.height()), 0.1, settings.view_distance())
 
 	gl.MatrixMode(gl.MODELVIEW)
 	gl.LoadIdentity()
@@ -509,12 +757,33 @@ func gluPerspective(fovy, aspect, near, far float32) {
 func (self *Window) on_draw() {
 	// Called by pyglet to draw the canvas.
 
+	sky := sky_color(self.model.time)
+	gl.ClearColor(sky.r, sky.g, sky.b, 1)
+	set_fog_color(sky)
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 	self.set_3d()
-	self.model.batch.draw()
+	self.draw_sky()
+	gl.BindTexture(gl.TEXTURE_2D, self.texture)
+	self.model.draw(self.position)
+	self.draw_cracks()
 	self.draw_focused_block()
 	self.set_2d()
-	// self.draw_label()
+	self.draw_label()
+	if self.debug {
+		self.draw_debug()
+	}
+	if self.mode != SPECTATOR {
+		self.draw_hotbar()
+	}
+	if self.mode == SURVIVAL {
+		self.draw_stats()
+	}
+	if self.inventory_open {
+		self.draw_inventory()
+	}
+	if self.dead() {
+		self.draw_death_screen()
+	}
 	self.draw_reticle()
 	self.glwindow.SwapBuffers()
 }
@@ -523,6 +792,10 @@ func (self *Window) draw_focused_block() {
 	// Draw black edges around the block that is currently under the crosshairs.
 
 	//
+	if self.mode == SPECTATOR {
+		// Spectators can't do anything to it.
+		return
+	}
 	vector := self.get_sight_vector()
 	block, _ := self.model.hit_test(self.position, vector, 8)
 	if !block.isNil() {
@@ -534,16 +807,14 @@ func (self *Window) draw_focused_block() {
 	}
 }
 
-/*
 func (self *Window) draw_label() {
 	// Draw the label in the top left of the screen.
 
 	self.label.text = fmt.Sprintf("%02d (%.2f, %.2f, %.2f) %d / %d",
-		pyglet.clock.get_fps(), self.position.x, self.position.y, self.position.z,
+		int(self.fps), self.position.x, self.position.y, self.position.z,
 		len(self.model._shown), len(self.model.world))
 	self.label.draw()
 }
-*/
 
 func (self *Window) draw_reticle() {
 	// Draw the crosshairs in the center of the screen.